@@ -0,0 +1,111 @@
+// Command isosim envia uma mensagem de autorização ISO 8583 para o servidor
+// TCP da API e imprime a resposta, para testes locais.
+//
+//	go run ./code/transactions/cmd/isosim -addr localhost:8583 -pan 6504871234567891 \
+//		-amount 10.50 -mcc 5812 -merchant "UBER EATS" -acceptor 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"cajueiro/pkg/iso8583"
+	"cajueiro/pkg/money"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8583", "endereço do servidor ISO 8583")
+	mti := flag.String("mti", "0200", "MTI da mensagem (0100 ou 0200)")
+	pan := flag.String("pan", "", "PAN do portador (campo 2)")
+	amount := flag.String("amount", "", "valor da transação, ex.: 10.50 (campo 4)")
+	mcc := flag.String("mcc", "", "mcc do estabelecimento (campo 18)")
+	merchant := flag.String("merchant", "", "nome do estabelecimento (campo 43)")
+	city := flag.String("city", "", "cidade do estabelecimento (campo 43)")
+	acceptor := flag.String("acceptor", "", "código do estabelecimento/conta de destino (campo 42)")
+	timeout := flag.Duration("timeout", 5*time.Second, "tempo máximo de espera pela resposta")
+	flag.Parse()
+
+	value, err := money.Parse(*amount)
+	if err != nil || *pan == "" || *acceptor == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	now := time.Now()
+
+	req := iso8583.NewMessage(*mti)
+	req.Set(2, *pan)
+	req.Set(3, "000000")
+	req.Set(4, strconv.FormatInt(value.Cents(), 10))
+	req.Set(7, now.UTC().Format("0102150405"))
+	req.Set(11, fmt.Sprintf("%06d", rand.Intn(1000000)))
+	req.Set(12, now.Format("150405"))
+	req.Set(13, now.Format("0102"))
+	req.Set(37, fmt.Sprintf("%012d", rand.Int63n(1e12)))
+	req.Set(41, "SIM00001")
+	req.Set(42, *acceptor)
+	req.Set(49, "986")
+	if *mcc != "" {
+		req.Set(18, *mcc)
+	}
+	if *merchant != "" {
+		req.Set(43, fmt.Sprintf("%-25.25s%-13.13s%-2.2s", *merchant, *city, "BR"))
+	}
+
+	b, err := req.Pack()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	conn, err := net.DialTimeout("tcp", *addr, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*timeout))
+
+	dump(">>", req)
+
+	if err := iso8583.WriteFrame(conn, b); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	frame, err := iso8583.ReadFrame(conn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	resp, err := iso8583.Unpack(frame)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dump("<<", resp)
+}
+
+// dump imprime o MTI e os campos da mensagem em ordem
+func dump(prefix string, m *iso8583.Message) {
+	fmt.Printf("%s MTI %s\n", prefix, m.MTI)
+
+	fields := make([]int, 0, len(m.Fields))
+	for f := range m.Fields {
+		fields = append(fields, f)
+	}
+	sort.Ints(fields)
+
+	for _, f := range fields {
+		fmt.Printf("%s DE%03d %q\n", prefix, f, m.Get(f))
+	}
+}
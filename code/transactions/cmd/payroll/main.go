@@ -0,0 +1,120 @@
+// Comando payroll importa o arquivo da folha de benefícios de um empregador
+// direto no banco, com a mesma validação e o mesmo lote da rota
+// POST /admin/employers/{id}/payroll:
+//
+//	payroll -employer 1 -file folha.csv [-format csv|fixed] [-mode atomic|per_line]
+//	payroll -status <lote>
+//	payroll -resume <lote>
+//
+// As variáveis de ambiente são lidas do arquivo informado em -env. O comando
+// termina com código 1 quando o lote é rejeitado ou fica com linhas pendentes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/payroll"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+func main() {
+
+	env := flag.String("env", ".env", "arquivo com as variáveis de ambiente")
+	employerID := flag.Int("employer", 0, "id do empregador")
+	file := flag.String("file", "", "arquivo da folha")
+	format := flag.String("format", payroll.FormatCSV, "formato do arquivo: csv ou fixed")
+	mode := flag.String("mode", models.PayrollAtomic, "modo do crédito: atomic ou per_line")
+	status := flag.String("status", "", "id do lote a consultar")
+	resume := flag.String("resume", "", "id do lote a retomar")
+	flag.Parse()
+
+	viper.SetConfigFile(*env)
+	if err := viper.ReadInConfig(); err != nil {
+		fail(fmt.Errorf("Falha ao carregar %s: %v", *env, err))
+	}
+
+	api, err := app.GetApp()
+	if err != nil {
+		fail(err)
+	}
+	defer api.DB.CloseDB()
+
+	var batch *models.PayrollBatch
+	switch {
+	case *status != "":
+		batch, err = models.FindPayrollBatch(api, parseID(*status))
+	case *resume != "":
+		batch, err = models.ProcessPayrollBatch(api, parseID(*resume))
+	case *employerID != 0 && *file != "":
+		batch, err = importFile(api, *employerID, *file, *format, *mode)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if batch != nil {
+		report(batch)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if batch.Status != models.PayrollCompleted {
+		os.Exit(1)
+	}
+}
+
+// importFile valida o arquivo, grava o lote e credita as linhas
+func importFile(api *app.App, employerID int, file, format, mode string) (*models.PayrollBatch, error) {
+
+	employer, err := models.FindEmployer(api, employerID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := models.CreatePayrollBatch(api, employer, format, mode, data)
+	if err != nil || batch.Status == models.PayrollRejected {
+		return batch, err
+	}
+
+	return models.ProcessPayrollBatch(api, batch.ID)
+}
+
+// report imprime a situação do lote e o erro de cada linha
+func report(batch *models.PayrollBatch) {
+	fmt.Printf("lote %s: %s, total %s\n", batch.ID, batch.Status, batch.Total)
+	for status, n := range batch.Summary {
+		fmt.Printf("  %s: %d\n", status, n)
+	}
+	for _, l := range batch.Lines {
+		if l.Error != "" {
+			fmt.Fprintf(os.Stderr, "linha %d (%s %s): %s\n", l.Line, l.CPF, l.Wallet, l.Error)
+		}
+	}
+}
+
+// parseID converte o id do lote informado na linha de comando
+func parseID(s string) uuid.UUID {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		fail(fmt.Errorf("Identificador de lote inválido: %s", s))
+	}
+	return id
+}
+
+// fail imprime o erro e termina o comando
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
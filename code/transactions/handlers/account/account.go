@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"cajueiro/code/transactions/handlers/params"
 	"cajueiro/code/transactions/models"
 	"cajueiro/pkg/app"
 
@@ -18,7 +20,7 @@ func ListAccounts(app *app.App) http.HandlerFunc {
 
 		//Pegando as contas no banco de dados
 		var a []models.Account
-		if err := app.DB.Client.Find(&a); err.Error != nil {
+		if err := app.DB.Client.Preload("Wallets").Find(&a); err.Error != nil {
 			// Se encontrar erro, retorna StatusInternalServerError (erro 500)
 			http.Error(w, "Erro ao listar as contas", http.StatusInternalServerError)
 			return
@@ -56,7 +58,11 @@ func PostAccount(app *app.App) http.HandlerFunc {
 
 		// armazenando struct account no DB
 		account, err := a.CreateAccount(app)
-		if err != nil {
+		if err == models.ErrEmployerNotFound {
+			// empregador informado não existe retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
 			// caso tenha erro ao armazenar no banco retorna 500
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -69,26 +75,149 @@ func PostAccount(app *app.App) http.HandlerFunc {
 	}
 }
 
-// BalanceAccount retorna o saldo da conta no banco de dados
+// período padrão do extrato quando from não é informado
+const statementPeriod = 30 * 24 * time.Hour
+
+// BalanceAccount retorna o saldo da conta no banco de dados; com o parâmetro
+// at retorna o saldo naquele instante, reconstruído pelo livro-razão
 func BalanceAccount(app *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
+		// saldo, atual ou histórico, só para o dono da conta ou para o operador
+		if !ownerOrAdmin(app, w, r) {
+			return
+		}
+
 		// Pegando id na url
 		id := mux.Vars(r)["id"]
 
 		// Pegando account no banco de dados
 		a := &models.Account{}
-		if err := app.DB.Client.First(&a, &id); err.Error != nil {
+		if err := app.DB.Client.Preload("Wallets").First(&a, &id); err.Error != nil {
 			// caso tenha erro ao procurar no banco retorna 404
 			http.Error(w, "Conta não encontrada", http.StatusNotFound)
 			return
 		}
 
+		// saldo atual
+		if r.URL.Query().Get("at") == "" {
+			balances, err := a.Balances(app, app.DB.Client.WithContext(r.Context()))
+			if err != nil {
+				// caso tenha erro ao procurar no banco retorna 500
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(balances)
+			return
+		}
+
+		at, err := params.Time(r.URL.Query().Get("at"), true)
+		if err != nil {
+			http.Error(w, "Parâmetro at inválido", http.StatusBadRequest)
+			return
+		}
+
+		balances, err := a.BalancesAt(app, app.DB.Client.WithContext(r.Context()), at)
+		if err != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]float64{"amount_food": a.Amount_food})
-		json.NewEncoder(w).Encode(map[string]float64{"amount_meal": a.Amount_meal})
-		json.NewEncoder(w).Encode(map[string]float64{"amount_cash": a.Amount_cash})
+		json.NewEncoder(w).Encode(balances)
+	}
+}
+
+// StatementAccount retorna o extrato da conta entre from e to, por padrão
+// os últimos 30 dias, com o saldo da carteira após cada lançamento
+//
+// O formato segue o parâmetro format (json, csv, ofx ou pdf) ou o cabeçalho
+// Accept. Todos os formatos são gerados enquanto os lançamentos são lidos do
+// banco, sem carregar o período inteiro em memória.
+func StatementAccount(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// extrato só para o dono da conta ou para o operador
+		if !ownerOrAdmin(app, w, r) {
+			return
+		}
+
+		// Pegando id na url
+		id := mux.Vars(r)["id"]
+
+		format, ok := statementFormat(r)
+		if !ok {
+			http.Error(w, "Parâmetro format inválido", http.StatusBadRequest)
+			return
+		}
+
+		// período do extrato
+		to := time.Now()
+		if v := r.URL.Query().Get("to"); v != "" {
+			t, err := params.Time(v, true)
+			if err != nil {
+				http.Error(w, "Parâmetro to inválido", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+		from := to.Add(-statementPeriod)
+		if v := r.URL.Query().Get("from"); v != "" {
+			t, err := params.Time(v, false)
+			if err != nil {
+				http.Error(w, "Parâmetro from inválido", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+		if from.After(to) {
+			http.Error(w, "Parâmetro from deve ser anterior a to", http.StatusBadRequest)
+			return
+		}
+
+		// Pegando account no banco de dados
+		a := &models.Account{}
+		if err := app.DB.Client.First(&a, &id); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 404
+			http.Error(w, "Conta não encontrada", http.StatusNotFound)
+			return
+		}
+
+		db := app.DB.Client.WithContext(r.Context())
+		w.Header().Set("Vary", "Accept")
+
+		statement, err := a.StatementBalances(app, db, from, to)
+		if err != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypes[format])
+		if format != formatJSON {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="extrato-%d.%s"`, a.ID, format))
+		}
+		w.WriteHeader(http.StatusOK)
+
+		// a partir daqui o status já foi enviado; erros só são registrados
+		sw := newStatementWriter(format, w)
+		if err := sw.begin(statement); err != nil {
+			app.Log.Error(err.Error())
+			return
+		}
+		if err := a.StatementLines(db, from, to, sw.line); err != nil {
+			app.Log.Error(err.Error())
+			return
+		}
+		if err := sw.end(statement); err != nil {
+			app.Log.Error(err.Error())
+		}
 	}
 }
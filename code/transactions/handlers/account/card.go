@@ -0,0 +1,120 @@
+package account
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ListCards lista os cartões da conta
+func ListCards(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := accountOwner(app, w, r)
+		if !ok {
+			return
+		}
+
+		cards, err := models.FindCards(app, a.ID)
+		if err != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(cards)
+
+	}
+}
+
+// IssueCard emite um cartão para a conta; o PAN completo só aparece nesta resposta
+func IssueCard(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := accountOwner(app, w, r)
+		if !ok {
+			return
+		}
+
+		card, err := models.IssueCard(app, a.ID)
+		switch err {
+		case nil:
+		case models.ErrAccountStatus:
+			// conta bloqueada ou encerrada retorna 409
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			// caso tenha erro ao armazenar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(card)
+
+	}
+}
+
+// BlockCard bloqueia um cartão ativo da conta
+func BlockCard(app *app.App) http.HandlerFunc {
+	return changeCard(app, models.BlockCard)
+}
+
+// UnblockCard libera um cartão bloqueado da conta
+func UnblockCard(app *app.App) http.HandlerFunc {
+	return changeCard(app, models.UnblockCard)
+}
+
+// CancelCard cancela em definitivo um cartão da conta
+func CancelCard(app *app.App) http.HandlerFunc {
+	return changeCard(app, models.CancelCard)
+}
+
+// changeCard handler comum das mudanças de situação do cartão
+func changeCard(app *app.App, change func(*app.App, int, uuid.UUID) (*models.Card, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := accountOwner(app, w, r)
+		if !ok {
+			return
+		}
+
+		// Pegando token na url
+		token, err := uuid.Parse(mux.Vars(r)["token"])
+		if err != nil {
+			http.Error(w, models.ErrCardNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		card, err := change(app, a.ID, token)
+		switch err {
+		case nil:
+		case models.ErrCardNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrCardStatus:
+			// transição não permitida, por exemplo desbloquear um cartão cancelado
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(card)
+
+	}
+}
@@ -0,0 +1,252 @@
+package account
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/money"
+	"cajueiro/pkg/pdf"
+)
+
+// formatos de exportação do extrato
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatOFX  = "ofx"
+	formatPDF  = "pdf"
+)
+
+// content types de cada formato
+var contentTypes = map[string]string{
+	formatJSON: "application/json",
+	formatCSV:  "text/csv; charset=utf-8",
+	formatOFX:  "application/x-ofx",
+	formatPDF:  "application/pdf",
+}
+
+// statementWriter escreve o extrato em um formato de exportação, recebendo os
+// lançamentos um a um
+type statementWriter interface {
+	begin(s *models.Statement) error
+	line(l models.StatementLine) error
+	end(s *models.Statement) error
+}
+
+// statementFormat escolhe o formato pelo parâmetro format ou pelo cabeçalho
+// Accept; sem preferência reconhecida o extrato é JSON
+func statementFormat(r *http.Request) (string, bool) {
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		_, ok := contentTypes[f]
+		return f, ok
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return formatCSV, true
+	case strings.Contains(accept, "application/x-ofx"):
+		return formatOFX, true
+	case strings.Contains(accept, "application/pdf"):
+		return formatPDF, true
+	}
+	return formatJSON, true
+}
+
+// newStatementWriter retorna o writer do formato informado
+func newStatementWriter(format string, w io.Writer) statementWriter {
+	switch format {
+	case formatJSON:
+		return &jsonWriter{w: w}
+	case formatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}
+	case formatOFX:
+		return &ofxWriter{w: w}
+	default:
+		return &pdfWriter{w: pdf.NewWriter(w)}
+	}
+}
+
+// jsonWriter escreve o extrato no mesmo JSON de models.Statement, com o
+// array lines gerado um lançamento por vez
+type jsonWriter struct {
+	w     io.Writer
+	lines int
+}
+
+func (j *jsonWriter) begin(s *models.Statement) error {
+	// lines é o último campo: o cabeçalho é o extrato sem lançamentos até a
+	// abertura do array
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(bytes.TrimSuffix(b, []byte("]}")))
+	return err
+}
+
+func (j *jsonWriter) line(l models.StatementLine) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if j.lines > 0 {
+		b = append([]byte(","), b...)
+	}
+	j.lines++
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter) end(s *models.Statement) error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
+
+// csvWriter exporta uma linha por lançamento
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) begin(s *models.Statement) error {
+	return c.w.Write([]string{"created", "transaction_id", "type", "description", "merchant", "wallet", "amount", "balance"})
+}
+
+func (c *csvWriter) line(l models.StatementLine) error {
+	id := ""
+	if l.Transaction_id != nil {
+		id = l.Transaction_id.String()
+	}
+	return c.w.Write([]string{
+		l.Created.Format(time.RFC3339), id, l.Type, l.Description, l.Merchant, l.Wallet,
+		l.Amount.String(), l.Balance.String(),
+	})
+}
+
+func (c *csvWriter) end(s *models.Statement) error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ofxWriter exporta no formato OFX 1.02 (SGML), aceito pelos gerenciadores
+// financeiros; as carteiras aparecem no memo de cada lançamento
+type ofxWriter struct {
+	w io.Writer
+}
+
+// ofxTime formata o instante no padrão do OFX
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// ofxEscape escapa os caracteres reservados do SGML
+var ofxEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (o *ofxWriter) begin(s *models.Statement) error {
+	_, err := fmt.Fprintf(o.w, "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\n"+
+		"ENCODING:UTF-8\r\nCHARSET:NONE\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n"+
+		"<OFX>\r\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>%s<LANGUAGE>POR</SONRS></SIGNONMSGSRSV1>\r\n"+
+		"<BANKMSGSRSV1><STMTTRNRS><TRNUID>%d<STATUS><CODE>0<SEVERITY>INFO</STATUS>\r\n"+
+		"<STMTRS><CURDEF>BRL<BANKACCTFROM><BANKID>0000<ACCTID>%d<ACCTTYPE>CHECKING</BANKACCTFROM>\r\n"+
+		"<BANKTRANLIST><DTSTART>%s<DTEND>%s\r\n",
+		ofxTime(time.Now()), s.Account_id, s.Account_id, ofxTime(s.From), ofxTime(s.To))
+	return err
+}
+
+func (o *ofxWriter) line(l models.StatementLine) error {
+	kind := "CREDIT"
+	if l.Amount < 0 {
+		kind = "DEBIT"
+	}
+	_, err := fmt.Fprintf(o.w, "<STMTTRN><TRNTYPE>%s<DTPOSTED>%s<TRNAMT>%s<FITID>%d<NAME>%s<MEMO>%s</STMTTRN>\r\n",
+		kind, ofxTime(l.Created), l.Amount.String(), l.Entry_id,
+		ofxEscape.Replace(truncate(l.Description, 32)), ofxEscape.Replace(l.Wallet))
+	return err
+}
+
+func (o *ofxWriter) end(s *models.Statement) error {
+	_, err := fmt.Fprintf(o.w, "</BANKTRANLIST>\r\n<LEDGERBAL><BALAMT>%s<DTASOF>%s</LEDGERBAL>\r\n"+
+		"</STMTRS></STMTTRNRS></BANKMSGSRSV1>\r\n</OFX>\r\n",
+		total(s.Closing).String(), ofxTime(s.To))
+	return err
+}
+
+// pdfWriter exporta o extrato em texto, uma linha por lançamento
+type pdfWriter struct {
+	w *pdf.Writer
+}
+
+// pdfLine layout das colunas de um lançamento no PDF
+const pdfLine = "%-16s  %-30s  %-8s  %12s  %12s"
+
+func (p *pdfWriter) begin(s *models.Statement) error {
+	header := []string{
+		fmt.Sprintf("Extrato da conta %d", s.Account_id),
+		fmt.Sprintf("Período: %s a %s", s.From.Format("02/01/2006 15:04"), s.To.Format("02/01/2006 15:04")),
+		"",
+		"Saldo inicial: " + balances(s.Opening),
+		"",
+		fmt.Sprintf(pdfLine, "Data", "Descrição", "Carteira", "Valor", "Saldo"),
+	}
+	for _, h := range header {
+		if err := p.w.Line(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pdfWriter) line(l models.StatementLine) error {
+	return p.w.Line(fmt.Sprintf(pdfLine, l.Created.Format("02/01/2006 15:04"), truncate(l.Description, 30),
+		l.Wallet, l.Amount.String(), l.Balance.String()))
+}
+
+func (p *pdfWriter) end(s *models.Statement) error {
+	if err := p.w.Line(""); err != nil {
+		return err
+	}
+	if err := p.w.Line("Saldo final: " + balances(s.Closing)); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
+
+// balances formata o saldo de cada carteira em ordem alfabética
+func balances(b map[string]money.Money) string {
+	categories := make([]string, 0, len(b))
+	for c := range b {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	parts := make([]string, len(categories))
+	for i, c := range categories {
+		parts[i] = c + " " + b[c].String()
+	}
+	return strings.Join(parts, "  ")
+}
+
+// total soma o saldo de todas as carteiras
+func total(b map[string]money.Money) money.Money {
+	var sum money.Money
+	for _, v := range b {
+		sum += v
+	}
+	return sum
+}
+
+// truncate limita o texto ao número de caracteres informado
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
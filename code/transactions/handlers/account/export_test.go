@@ -0,0 +1,54 @@
+package account
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/money"
+)
+
+func TestJSONWriterMatchesStatement(t *testing.T) {
+	to := time.Date(2021, 3, 31, 23, 59, 59, 0, time.UTC)
+	s := &models.Statement{
+		Account_id: 1,
+		From:       to.AddDate(0, 0, -30),
+		To:         to,
+		Opening:    map[string]money.Money{models.WalletCash: money.FromCents(10000)},
+		Closing:    map[string]money.Money{models.WalletCash: money.FromCents(5000)},
+		Lines:      []models.StatementLine{},
+	}
+	lines := []models.StatementLine{
+		{Entry_id: 1, Created: to.Add(-time.Hour), Description: "Compra Padaria", Wallet: models.WalletCash, Amount: money.FromCents(-3000), Balance: money.FromCents(7000)},
+		{Entry_id: 2, Created: to, Description: "Compra Padaria", Wallet: models.WalletCash, Amount: money.FromCents(-2000), Balance: money.FromCents(5000)},
+	}
+
+	for _, n := range []int{0, len(lines)} {
+		var b bytes.Buffer
+		jw := newStatementWriter(formatJSON, &b)
+		if err := jw.begin(s); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range lines[:n] {
+			if err := jw.line(l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := jw.end(s); err != nil {
+			t.Fatal(err)
+		}
+
+		got := models.Statement{}
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatalf("Expected valid JSON with %d lines. Got %q: %v", n, b.String(), err)
+		}
+		want := *s
+		want.Lines = append([]models.StatementLine{}, lines[:n]...)
+		if !reflect.DeepEqual(got.Lines, want.Lines) || got.Account_id != want.Account_id || !reflect.DeepEqual(got.Closing, want.Closing) {
+			t.Errorf("Expected %+v. Got %+v", want, got)
+		}
+	}
+}
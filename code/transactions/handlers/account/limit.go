@@ -0,0 +1,162 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cajueiro/code/transactions/handlers/auth"
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// ListLimits lista os limites de gasto das carteiras da conta
+func ListLimits(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := accountOwner(app, w, r)
+		if !ok {
+			return
+		}
+
+		limits, err := models.FindLimits(app, a.ID)
+		if err != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(limits)
+
+	}
+}
+
+// PutLimit cria ou substitui os limites de gasto da carteira da conta; rota
+// administrativa
+func PutLimit(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := limitAccount(app, w, r)
+		if !ok {
+			return
+		}
+
+		// capturando os limites no request
+		l := &models.SpendingLimit{}
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+		l.Account_id = a.ID
+		l.Wallet = mux.Vars(r)["wallet"]
+
+		// validando json dos limites
+		if err := app.Vld.Struct(l); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		limit, err := l.SaveLimit(app)
+		if err != nil {
+			// caso tenha erro ao armazenar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(limit)
+
+	}
+}
+
+// DeleteLimit remove os limites de gasto da carteira da conta; rota
+// administrativa
+func DeleteLimit(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		a, ok := limitAccount(app, w, r)
+		if !ok {
+			return
+		}
+
+		err := models.DeleteLimit(app, a.ID, mux.Vars(r)["wallet"])
+		if err == models.ErrLimitNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
+
+// accountOwner autentica o portador do token JWT e confere se ele é o dono
+// da conta da url; em caso de falha a resposta já foi escrita
+func accountOwner(app *app.App, w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+
+	a, ok := auth.Authenticate(app, w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// Pegando id na url
+	if id, err := strconv.Atoi(mux.Vars(r)["id"]); err != nil || id != a.ID {
+		// conta de outro portador retorna 403
+		http.Error(w, "Acesso negado à conta", http.StatusForbidden)
+		return nil, false
+	}
+
+	return a, true
+}
+
+// limitAccount procura a conta da url nas rotas administrativas dos limites;
+// em caso de falha a resposta já foi escrita
+func limitAccount(app *app.App, w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+
+	// Pegando id na url
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, models.ErrAccountNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+
+	a, err := models.FindAccount(app, id)
+	if err == models.ErrAccountNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return a, true
+}
+
+// ownerOrAdmin aceita o token administrativo ou o token JWT do dono da conta
+// da url; em caso de falha a resposta já foi escrita
+func ownerOrAdmin(app *app.App, w http.ResponseWriter, r *http.Request) bool {
+
+	if auth.Admin(app, r) {
+		return true
+	}
+
+	_, ok := accountOwner(app, w, r)
+	return ok
+}
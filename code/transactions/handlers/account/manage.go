@@ -0,0 +1,208 @@
+package account
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// GetAccount retorna a conta com as suas carteiras e a versão no cabeçalho ETag
+func GetAccount(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// Pegando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrAccountNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		a, err := models.FindAccount(app, id)
+		if err == models.ErrAccountNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeAccount(w, a)
+
+	}
+}
+
+// PatchAccount altera o CPF, o fallback para cash ou o empregador da conta
+//
+// O cabeçalho If-Match com o ETag da última leitura é obrigatório: se a conta
+// foi alterada desde então a resposta é 412 Precondition Failed e nada muda.
+func PatchAccount(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// Pegando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrAccountNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		// versão da conta lida pelo cliente
+		match := r.Header.Get("If-Match")
+		if match == "" {
+			http.Error(w, "Cabeçalho If-Match obrigatório", http.StatusPreconditionRequired)
+			return
+		}
+		version, ok := parseETag(match)
+		if !ok {
+			http.Error(w, "Cabeçalho If-Match inválido", http.StatusBadRequest)
+			return
+		}
+
+		p := &models.AccountPatch{}
+		if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json da alteração
+		if err := app.Vld.Struct(p); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		a, err := p.UpdateAccount(app, id, version)
+		switch err {
+		case nil:
+		case models.ErrAccountNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrAccountVersion:
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		case models.ErrAccountStatus, models.ErrAccountCPF:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case models.ErrEmployerNotFound:
+			// empregador informado não existe retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeAccount(w, a)
+
+	}
+}
+
+// BlockAccount bloqueia a conta ativa; o motivo é obrigatório
+func BlockAccount(app *app.App) http.HandlerFunc {
+	return changeAccount(app, true, models.BlockAccount)
+}
+
+// UnblockAccount libera a conta bloqueada; o motivo é obrigatório
+func UnblockAccount(app *app.App) http.HandlerFunc {
+	return changeAccount(app, true, models.UnblockAccount)
+}
+
+// CloseAccount encerra a conta, que precisa estar com todas as carteiras zeradas
+func CloseAccount(app *app.App) http.HandlerFunc {
+	return changeAccount(app, false, models.CloseAccount)
+}
+
+// RestoreAccount reabre a conta encerrada
+func RestoreAccount(app *app.App) http.HandlerFunc {
+	return changeAccount(app, false, models.RestoreAccount)
+}
+
+// changeAccount handler das mudanças de situação da conta, com o motivo
+// opcional no corpo do request
+func changeAccount(app *app.App, requireReason bool, change func(*app.App, int, string) (*models.Account, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// Pegando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrAccountNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Erro na leitura do request", http.StatusBadRequest)
+			return
+		}
+		request := struct {
+			Reason string `json:"reason"`
+		}{}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &request); err != nil {
+				// caso tenha erro no decode do request retorna 400
+				http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+				return
+			}
+		}
+		if requireReason && strings.TrimSpace(request.Reason) == "" {
+			http.Error(w, "Motivo obrigatório", http.StatusBadRequest)
+			return
+		}
+
+		a, err := change(app, id, strings.TrimSpace(request.Reason))
+		switch err {
+		case nil:
+		case models.ErrAccountNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrAccountStatus, models.ErrAccountBalance:
+			// situação que não permite a operação ou saldo no encerramento retorna 409
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeAccount(w, a)
+
+	}
+}
+
+// writeAccount responde a conta com a versão no cabeçalho ETag
+func writeAccount(w http.ResponseWriter, a *models.Account) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(a.Version)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a)
+}
+
+// parseETag lê a versão da conta do cabeçalho If-Match; "*" aceita qualquer
+// versão e retorna zero
+func parseETag(value string) (int, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	if value == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(value, `"`))
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Authenticate valida o token JWT do cabeçalho e retorna a conta do portador;
+// em caso de falha a resposta já foi escrita
+func Authenticate(app *app.App, w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+
+	// capturando o token JWT no cabeçalho do request
+	if r.Header["Token"] == nil {
+		// caso o token seja nulo retorna 401
+		http.Error(w, "Token nulo", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Parse da string JWT e armazena o resultado no struct claims
+	claims := &models.Claims{}
+	tkn, err := jwt.ParseWithClaims(r.Header.Get("Token"), claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(app.Cfg.GetTokenKey()), nil
+	})
+	if err != nil {
+		if err == jwt.ErrSignatureInvalid {
+			http.Error(w, "Assinatura inválida", http.StatusUnauthorized)
+			return nil, false
+		}
+		http.Error(w, "Token inválido", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !tkn.Valid {
+		http.Error(w, "Token Expirou", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// capturando account no DB
+	a := &models.Account{}
+	if err := app.DB.Client.WithContext(r.Context()).First(&a, "cpf = ?", claims.CPF); err.Error != nil {
+		// conta removida depois da emissão do token
+		http.Error(w, "Conta não encontrada", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return a, true
+}
+
+// Admin indica se o request traz o token administrativo no cabeçalho Admin-Token
+func Admin(app *app.App, r *http.Request) bool {
+	token := app.Cfg.GetAdminToken()
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Admin-Token")), []byte(token)) == 1
+}
+
+// AccountOrAdmin retorna a conta do token JWT ou zero quando o request traz o
+// token administrativo; em caso de falha a resposta já foi escrita
+func AccountOrAdmin(app *app.App, w http.ResponseWriter, r *http.Request) (int, bool) {
+
+	if Admin(app, r) {
+		return 0, true
+	}
+
+	a, ok := Authenticate(app, w, r)
+	if !ok {
+		return 0, false
+	}
+
+	return a.ID, true
+}
@@ -0,0 +1,221 @@
+package employer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// ListEmployers lista os empregadores com os seus créditos agendados
+func ListEmployers(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando os empregadores no DB
+		var e []models.Employer
+		if err := app.DB.Client.Preload("Schedules").Order("id").Find(&e); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, "Erro ao listar os empregadores", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(e)
+
+	}
+}
+
+// PostEmployer cria um empregador com os seus créditos agendados
+func PostEmployer(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando o empregador no request
+		e := &models.Employer{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json do empregador
+		if err := app.Vld.Struct(e); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// armazenando o empregador no DB
+		employer, err := e.CreateEmployer(app)
+		if err != nil {
+			// caso tenha erro ao armazenar no banco retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(employer)
+
+	}
+}
+
+// GetEmployer retorna o empregador com os seus créditos agendados
+func GetEmployer(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		employer, ok := findEmployer(app, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(employer)
+
+	}
+}
+
+// PostCreditSchedule agenda um crédito mensal do empregador
+func PostCreditSchedule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		employer, ok := findEmployer(app, w, r)
+		if !ok {
+			return
+		}
+
+		// capturando o agendamento no request
+		s := &models.CreditSchedule{}
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json do agendamento
+		if err := app.Vld.Struct(s); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// armazenando o agendamento no DB
+		schedule, err := s.CreateCreditSchedule(app, employer.ID)
+		if err != nil {
+			// caso tenha erro ao armazenar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(schedule)
+
+	}
+}
+
+// DeleteCreditSchedule cancela um crédito agendado do empregador; os
+// créditos já lançados não são alterados
+func DeleteCreditSchedule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando ids na url
+		employerID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+		scheduleID, err := strconv.Atoi(mux.Vars(r)["schedule"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		result := app.DB.Client.Where("employer_id = ?", employerID).Delete(&models.CreditSchedule{}, scheduleID)
+		if result.Error != nil {
+			// caso tenha erro ao remover no banco retorna 500
+			http.Error(w, "Erro ao cancelar o crédito agendado", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			http.Error(w, "Crédito agendado não encontrado", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
+
+// LinkAccount vincula uma conta existente ao empregador
+func LinkAccount(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		employer, ok := findEmployer(app, w, r)
+		if !ok {
+			return
+		}
+
+		// capturando id da conta na url
+		accountID, err := strconv.Atoi(mux.Vars(r)["account"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		err = employer.LinkAccount(app, accountID)
+		if err == models.ErrAccountNotFound {
+			// caso a conta não exista retorna 404
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			// caso tenha erro ao atualizar no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
+
+// findEmployer procura o empregador do id da url; em caso de falha a
+// resposta já foi escrita
+func findEmployer(app *app.App, w http.ResponseWriter, r *http.Request) (*models.Employer, bool) {
+
+	// capturando id na url
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Identificador inválido", http.StatusBadRequest)
+		return nil, false
+	}
+
+	employer, err := models.FindEmployer(app, id)
+	if err == models.ErrEmployerNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return employer, true
+}
@@ -0,0 +1,170 @@
+package employer
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/payroll"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// tamanho máximo do arquivo da folha
+const maxPayrollSize = 10 << 20
+
+// PostPayroll importa o arquivo da folha de benefícios do empregador,
+// valida todas as linhas e credita o lote
+//
+// O arquivo vem no corpo do request ou no campo file de um formulário
+// multipart. O formato (csv ou fixed) e o modo (atomic ou per_line) vêm dos
+// parâmetros format e mode; o padrão é csv e atomic. Um lote rejeitado na
+// validação retorna 422 com o erro de cada linha.
+func PostPayroll(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		employer, ok := findEmployer(app, w, r)
+		if !ok {
+			return
+		}
+
+		// capturando o arquivo no request
+		data, err := payrollFile(w, r)
+		if err != nil {
+			http.Error(w, "Arquivo inválido", http.StatusBadRequest)
+			return
+		}
+
+		format := strings.ToLower(r.URL.Query().Get("format"))
+		if format == "" {
+			format = payroll.FormatCSV
+		}
+		mode := strings.ToLower(r.URL.Query().Get("mode"))
+		if mode == "" {
+			mode = models.PayrollAtomic
+		}
+
+		// validando e gravando o lote
+		batch, err := models.CreatePayrollBatch(app, employer, format, mode, data)
+		if _, ok := err.(*models.ErrPayrollDuplicate); ok {
+			// caso o arquivo já tenha sido importado retorna 409
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			// caso o arquivo seja inválido retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if batch.Status == models.PayrollRejected {
+			// caso alguma linha seja inválida no modo atômico retorna 422
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(batch)
+			return
+		}
+
+		// creditando o lote
+		processed, err := models.ProcessPayrollBatch(app, batch.ID)
+		if err != nil {
+			// o lote fica com a situação failed e pode ser retomado
+			app.Log.Error(err.Error())
+			processed, err = models.FindPayrollBatch(app, batch.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(processed)
+
+	}
+}
+
+// GetPayroll retorna a situação do lote com cada uma das linhas
+func GetPayroll(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		batch, err := models.FindPayrollBatch(app, id)
+		if err == models.ErrPayrollNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(batch)
+
+	}
+}
+
+// ResumePayroll retoma o crédito de um lote interrompido, creditando apenas
+// as linhas que ainda não foram creditadas
+func ResumePayroll(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		batch, err := models.ProcessPayrollBatch(app, id)
+		switch err {
+		case nil:
+		case models.ErrPayrollNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrPayrollRejected:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(batch)
+
+	}
+}
+
+// payrollFile lê o arquivo do campo file do formulário multipart ou do corpo do request
+func payrollFile(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPayrollSize)
+
+	var file io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		file = f
+	}
+
+	return ioutil.ReadAll(file)
+}
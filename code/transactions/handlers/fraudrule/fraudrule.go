@@ -0,0 +1,153 @@
+package fraudrule
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// ListFraudRules lista as regras antifraude
+func ListFraudRules(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando as regras no DB
+		var f []models.FraudRule
+		if err := app.DB.Client.Order("id").Find(&f); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, "Erro ao listar as regras antifraude", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(f)
+
+	}
+}
+
+// PostFraudRule cria uma regra antifraude
+func PostFraudRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando a regra no request
+		f, ok := decodeFraudRule(app, w, r)
+		if !ok {
+			return
+		}
+
+		// armazenando a regra no DB
+		rule, err := f.CreateFraudRule(app)
+		if err == models.ErrFraudRuleName {
+			// regra não registrada retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+
+	}
+}
+
+// PutFraudRule atualiza a ação e os parâmetros de uma regra antifraude
+func PutFraudRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		// capturando a regra no request
+		f, ok := decodeFraudRule(app, w, r)
+		if !ok {
+			return
+		}
+
+		// atualizando a regra no DB
+		rule, err := f.UpdateFraudRule(app, id)
+		switch err {
+		case nil:
+		case models.ErrFraudRuleNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrFraudRuleName:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rule)
+
+	}
+}
+
+// DeleteFraudRule remove uma regra antifraude
+func DeleteFraudRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		// removendo a regra no DB
+		err = models.DeleteFraudRule(app, id)
+		if err == models.ErrFraudRuleNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
+
+// decodeFraudRule lê e valida a regra do corpo do request; em caso de falha
+// a resposta já foi escrita
+func decodeFraudRule(app *app.App, w http.ResponseWriter, r *http.Request) (*models.FraudRule, bool) {
+
+	f := &models.FraudRule{}
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		// caso tenha erro no decode do request retorna 400
+		http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// validando json da regra
+	if err := app.Vld.Struct(f); err != nil {
+		// traduzindo os erros do JSON inválido
+		errs := app.TranslateErrors(err)
+		// caso o corpo do request seja inválido retorna 400
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, errs)
+		return nil, false
+	}
+
+	return f, true
+}
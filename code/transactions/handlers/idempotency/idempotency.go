@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+)
+
+// recorder repassa a resposta ao cliente e guarda o status e o corpo
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader guarda o status da resposta
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write guarda o corpo da resposta
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Run executa o handler uma única vez por chave de idempotência da conta
+//
+// A chave vem do cabeçalho Idempotency-Key ou, na falta dele, do valor
+// informado em fallback (por exemplo o external_id do adquirente). Sem chave
+// o handler é executado normalmente. Um request repetido com a mesma chave e
+// o mesmo conteúdo recebe a resposta original, sem executar o handler; com
+// outro conteúdo recebe 409.
+//
+// O handler recebe o request com a chave no contexto: a transação gravada com
+// esse contexto fica vinculada à chave no mesmo COMMIT. Assim, se o request
+// anterior gravou a transação e não chegou a armazenar a resposta, a nova
+// tentativa recebe a autorização dessa transação em vez de debitar de novo.
+func Run(app *app.App, w http.ResponseWriter, r *http.Request, accountID int, fallback string, body []byte, handle func(w http.ResponseWriter, r *http.Request)) {
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = fallback
+	}
+	if key == "" {
+		handle(w, r)
+		return
+	}
+	if len(key) > 255 {
+		http.Error(w, "Chave de idempotência muito longa", http.StatusBadRequest)
+		return
+	}
+
+	k, err := models.BeginIdempotency(app, accountID, key, models.RequestHash(r.Method, r.URL.Path, body))
+	switch err {
+	case nil:
+	case models.ErrIdempotencyConflict, models.ErrIdempotencyInProgress:
+		// caso a chave esteja em uso retorna 409
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// request repetido recebe a resposta original
+	if k.Status_code != 0 {
+		w.Header().Set("Content-Type", k.Content_type)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(k.Status_code)
+		w.Write(k.Response)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w}
+
+	// chave assumida de um request que já gravou a transação
+	transaction, err := k.Transaction(app)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if transaction != nil {
+		rec.Header().Set("Content-Type", "application/json")
+		rec.Header().Set("Idempotent-Replayed", "true")
+		rec.WriteHeader(models.HTTPStatus(transaction.Code))
+		json.NewEncoder(rec).Encode(transaction.Authorization())
+	} else {
+		handle(rec, r.WithContext(models.WithIdempotencyKey(r.Context(), k)))
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if err := k.CompleteIdempotency(app, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+		app.Log.Error(err.Error())
+	}
+}
@@ -0,0 +1,202 @@
+package iso
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/iso8583"
+	"cajueiro/pkg/money"
+)
+
+// campos da ISO 8583 usados na autorização
+const (
+	fieldPAN       = 2
+	fieldAmount    = 4
+	fieldSTAN      = 11
+	fieldMCC       = 18
+	fieldRRN       = 37
+	fieldAuthCode  = 38
+	fieldResponse  = 39
+	fieldAcceptor  = 42
+	fieldMerchant  = 43
+	merchantLength = 25 // NOME DO ESTABELECIMENTO NAS PRIMEIRAS POSIÇÕES DO CAMPO 43
+)
+
+// campos da requisição repetidos na resposta
+var echoFields = []int{2, 3, 4, 7, 11, 12, 13, 18, 32, 37, 41, 42, 49}
+
+// contentType tipo da resposta armazenada na chave de idempotência
+const contentType = "application/iso8583"
+
+// Authorize handler das mensagens 0100/0200 que usa o mesmo núcleo de
+// autorização de POST /transactions e responde 0110/0210 com o campo 39
+//
+// O PAN (campo 2) identifica o cartão do portador, o campo 4 traz o valor em
+// centavos, o campo 18 o mcc, o campo 43 o nome do estabelecimento e o campo
+// 42 o código do estabelecimento, que é o id da conta a ser creditada.
+//
+// O orçamento de latência (AUTH_TIMEOUT_MS) vale para a mensagem inteira,
+// incluindo a busca do cartão pelo PAN.
+//
+// A retransmissão da rede (mesmo RRN e STAN, campos 37 e 11) passa pela mesma
+// chave de idempotência de POST /transactions, na conta do portador, e recebe
+// a resposta original sem autorizar de novo; com outro conteúdo é recusada
+// com "94".
+func Authorize(app *app.App) iso8583.HandlerFunc {
+	return func(req *iso8583.Message) *iso8583.Message {
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.Cfg.GetAuthTimeout())
+		defer cancel()
+
+		resp := iso8583.NewMessage(iso8583.ResponseMTI(req.MTI))
+		for _, f := range echoFields {
+			if req.Has(f) {
+				resp.Set(f, req.Get(f))
+			}
+		}
+
+		// apenas pedidos de autorização e financeiros são suportados
+		if req.MTI != "0100" && req.MTI != "0200" {
+			resp.Set(fieldResponse, models.CodeFormatError)
+			return resp
+		}
+
+		// montando a transação a partir dos campos da mensagem
+		amount, err := strconv.ParseInt(req.Get(fieldAmount), 10, 64)
+		destination, errDestination := strconv.Atoi(strings.TrimSpace(req.Get(fieldAcceptor)))
+		if err != nil || amount <= 0 || errDestination != nil || req.Get(fieldPAN) == "" {
+			resp.Set(fieldResponse, models.CodeFormatError)
+			return resp
+		}
+
+		// capturando o cartão do portador pelo PAN
+		card, err := models.FindCardByPAN(ctx, app, req.Get(fieldPAN))
+		if err != nil && ctx.Err() != nil {
+			resp.Set(fieldResponse, models.CodeTimeout)
+			return resp
+		}
+		if err != nil {
+			app.Log.Error(err.Error())
+			resp.Set(fieldResponse, models.CodeSystemError)
+			return resp
+		}
+		if card == nil {
+			resp.Set(fieldResponse, models.CodeInvalidAccount)
+			return resp
+		}
+
+		// a situação e a validade do cartão são verificadas na autorização
+		t := &models.Transaction{
+			Account_id:         card.Account_id,
+			Card_token:         card.Token.String(),
+			Accounttocredit_id: destination,
+			Amount:             money.FromCents(amount),
+			Mcc:                req.Get(fieldMCC),
+			Merchant:           merchantName(req.Get(fieldMerchant)),
+			External_id:        req.Get(fieldRRN),
+		}
+
+		// retransmissão com o mesmo RRN e STAN recebe a resposta original
+		if req.Get(fieldRRN) == "" || req.Get(fieldSTAN) == "" {
+			return authorize(ctx, app, t, resp)
+		}
+		packed, err := req.Pack()
+		if err != nil {
+			resp.Set(fieldResponse, models.CodeFormatError)
+			return resp
+		}
+		key := "iso:" + strings.TrimSpace(req.Get(fieldRRN)) + ":" + req.Get(fieldSTAN)
+		k, err := models.BeginIdempotency(app, card.Account_id, key, models.RequestHash("ISO", req.MTI, packed))
+		switch err {
+		case nil:
+		case models.ErrIdempotencyConflict:
+			resp.Set(fieldResponse, models.CodeDuplicate)
+			return resp
+		case models.ErrIdempotencyInProgress:
+			// a mensagem original ainda está em processamento
+			resp.Set(fieldResponse, models.CodeTimeout)
+			return resp
+		default:
+			app.Log.Error(err.Error())
+			resp.Set(fieldResponse, models.CodeSystemError)
+			return resp
+		}
+
+		if k.Status_code != 0 {
+			stored, err := iso8583.Unpack(k.Response)
+			if err != nil {
+				app.Log.Error("Erro ao repetir a resposta ISO 8583: " + err.Error())
+				resp.Set(fieldResponse, models.CodeSystemError)
+				return resp
+			}
+			return stored
+		}
+
+		// chave assumida de uma mensagem que já gravou a transação
+		transaction, err := k.Transaction(app)
+		if err != nil {
+			app.Log.Error(err.Error())
+			resp.Set(fieldResponse, models.CodeSystemError)
+		} else if transaction != nil {
+			respond(resp, transaction)
+		} else {
+			resp = authorize(models.WithIdempotencyKey(ctx, k), app, t, resp)
+		}
+
+		// falha do sistema libera a chave para a retransmissão
+		status := models.HTTPStatus(resp.Get(fieldResponse))
+		if resp.Get(fieldResponse) == models.CodeSystemError {
+			status = http.StatusInternalServerError
+		}
+		stored, err := resp.Pack()
+		if err != nil {
+			app.Log.Error("Erro ao armazenar a resposta ISO 8583: " + err.Error())
+			status, stored = http.StatusInternalServerError, nil
+		}
+		if err := k.CompleteIdempotency(app, status, contentType, stored); err != nil {
+			app.Log.Error(err.Error())
+		}
+
+		return resp
+	}
+}
+
+// authorize armazena a transação t no DB e preenche a resposta
+func authorize(ctx context.Context, app *app.App, t *models.Transaction, resp *iso8583.Message) *iso8583.Message {
+
+	transaction, err := t.CreateTransaction(ctx, app)
+	if err != nil {
+		app.Log.Error(err.Error())
+		resp.Set(fieldResponse, models.CodeSystemError)
+		return resp
+	}
+
+	respond(resp, transaction)
+	return resp
+}
+
+// respond preenche o código de resposta e, se aprovada, o código de autorização
+func respond(resp *iso8583.Message, transaction *models.Transaction) {
+	resp.Set(fieldResponse, transaction.Code)
+	if transaction.Approved() {
+		resp.Set(fieldAuthCode, authorizationCode(transaction))
+	}
+}
+
+// merchantName extrai o nome do estabelecimento do campo 43
+// (nome em 25 posições, cidade em 13 e país em 2)
+func merchantName(field43 string) string {
+	if len(field43) > merchantLength {
+		field43 = field43[:merchantLength]
+	}
+	return strings.TrimSpace(field43)
+}
+
+// authorizationCode gera o código de autorização de 6 posições a partir do id da transação
+func authorizationCode(t *models.Transaction) string {
+	return strings.ToUpper(strings.Replace(t.ID.String(), "-", "", -1)[:6])
+}
@@ -0,0 +1,29 @@
+package ledger
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+)
+
+// CheckLedger verifica se os lançamentos do livro-razão somam zero e se o
+// saldo das carteiras confere com os lançamentos
+func CheckLedger(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		check, err := models.CheckLedger(app.DB.Client.WithContext(r.Context()))
+		if err != nil {
+			// caso tenha erro ao consultar o banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(check)
+
+	}
+}
@@ -0,0 +1,140 @@
+package mcccategory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// ListMccCategories lista o mapeamento de mcc para categoria
+func ListMccCategories(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando o mapeamento no DB
+		var m []models.MccCategory
+		if err := app.DB.Client.Order("id").Find(&m); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, "Erro ao listar as categorias de mcc", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(m)
+
+	}
+}
+
+// PostMccCategory cria um mapeamento de mcc para categoria
+func PostMccCategory(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando o mapeamento no request
+		m := &models.MccCategory{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json do mapeamento
+		if err := app.Vld.Struct(m); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// armazenando o mapeamento no DB
+		category, err := m.CreateMccCategory(app)
+		if err != nil {
+			// caso tenha erro ao armazenar no banco retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(category)
+
+	}
+}
+
+// PutMccCategory atualiza um mapeamento de mcc para categoria
+func PutMccCategory(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		// capturando o mapeamento no request
+		m := &models.MccCategory{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json do mapeamento
+		if err := app.Vld.Struct(m); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// atualizando o mapeamento no DB
+		category, err := m.UpdateMccCategory(app, id)
+		if err != nil {
+			// caso não encontre ou seja inválida retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(category)
+
+	}
+}
+
+// DeleteMccCategory remove um mapeamento de mcc para categoria
+func DeleteMccCategory(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		// removendo o mapeamento no DB
+		if err := models.DeleteMccCategory(app, id); err != nil {
+			// caso não encontre ou tenha erro ao remover retorna 404
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
@@ -2,7 +2,9 @@ package merchant
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"cajueiro/code/transactions/models"
 	"cajueiro/pkg/app"
@@ -10,25 +12,166 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// ListMerchants - handler para listar os estabelecimentos no DB
+// ListMerchants - handler para listar os estabelecimentos no DB, com a
+// quantidade e o volume das compras; com o parâmetro q busca pelo nome
 func ListMerchants(app *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, request *http.Request) {
 		defer request.Body.Close()
 
-		// capturando nome do estabelecimento na url
-		merchant := mux.Vars(request)["merchant"]
-
 		// capturando estabelecimentos no DB
-		var t []models.Transaction
-		if err := app.DB.Client.Where("merchant LIKE ?", "%"+merchant+"%").Find(&t); err.Error != nil {
+		merchants, err := models.SearchMerchants(app, request.URL.Query().Get("q"))
+		if err != nil {
 			// caso tenha erro ao procurar no banco, retorna 500
-			http.Error(w, "Erro na listagem dos estabelecimentos", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(t)
+		json.NewEncoder(w).Encode(merchants)
 
 	}
 }
+
+// GetMerchant retorna o cadastro do estabelecimento
+func GetMerchant(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrMerchantNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		merchant, err := models.FindMerchant(app, id)
+		if err == models.ErrMerchantNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(merchant)
+
+	}
+}
+
+// PostMerchant cadastra um estabelecimento
+func PostMerchant(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		m, ok := decodeMerchant(app, w, r)
+		if !ok {
+			return
+		}
+
+		merchant, err := m.CreateMerchant(app)
+		if err == models.ErrMerchantDuplicate {
+			// nome normalizado já cadastrado retorna 409
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(merchant)
+
+	}
+}
+
+// PutMerchant atualiza o cadastro do estabelecimento
+func PutMerchant(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrMerchantNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		m, ok := decodeMerchant(app, w, r)
+		if !ok {
+			return
+		}
+
+		merchant, err := m.UpdateMerchant(app, id)
+		switch err {
+		case nil:
+		case models.ErrMerchantNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case models.ErrMerchantDuplicate:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(merchant)
+
+	}
+}
+
+// DeleteMerchant remove o estabelecimento
+func DeleteMerchant(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrMerchantNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = models.DeleteMerchant(app, id)
+		if err == models.ErrMerchantNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
+
+// decodeMerchant lê e valida o estabelecimento do corpo do request; em caso
+// de falha a resposta já foi escrita
+func decodeMerchant(app *app.App, w http.ResponseWriter, r *http.Request) (*models.Merchant, bool) {
+
+	m := &models.Merchant{}
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		// caso tenha erro no decode do request retorna 400
+		http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// validando json do estabelecimento
+	if err := app.Vld.Struct(m); err != nil {
+		// traduzindo os erros do JSON inválido
+		errs := app.TranslateErrors(err)
+		// caso o corpo do request seja inválido retorna 400
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, errs)
+		return nil, false
+	}
+
+	return m, true
+}
@@ -0,0 +1,143 @@
+package merchantrule
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+
+	"github.com/gorilla/mux"
+)
+
+// ListMerchantRules lista as regras do registro de estabelecimentos
+func ListMerchantRules(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando as regras no DB
+		var m []models.MerchantRule
+		if err := app.DB.Client.Order("id").Find(&m); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 500
+			http.Error(w, "Erro ao listar as regras dos estabelecimentos", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(m)
+
+	}
+}
+
+// PostMerchantRule cria uma regra no registro de estabelecimentos
+func PostMerchantRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando a regra no request
+		m := &models.MerchantRule{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json da regra
+		if err := app.Vld.Struct(m); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// armazenando a regra no DB
+		rule, err := m.CreateMerchantRule(app)
+		if err != nil {
+			// caso tenha erro ao armazenar no banco retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+
+	}
+}
+
+// PutMerchantRule atualiza uma regra do registro de estabelecimentos
+func PutMerchantRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		// capturando a regra no request
+		m := &models.MerchantRule{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			// caso tenha erro no decode do request retorna 400
+			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+			return
+		}
+
+		// validando json da regra
+		if err := app.Vld.Struct(m); err != nil {
+			// traduzindo os erros do JSON inválido
+			errs := app.TranslateErrors(err)
+			// caso o corpo do request seja inválido retorna 400
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, errs)
+			return
+		}
+
+		// atualizando a regra no DB
+		rule, err := m.UpdateMerchantRule(app, id)
+		if err != nil {
+			// caso não encontre ou seja inválida retorna 400
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rule)
+
+	}
+}
+
+// DeleteMerchantRule remove uma regra do registro de estabelecimentos
+func DeleteMerchantRule(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando id na url
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Identificador inválido", http.StatusBadRequest)
+			return
+		}
+
+		err = models.DeleteMerchantRule(app, id)
+		if err == models.ErrMerchantRuleNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			// caso tenha erro ao remover no banco retorna 500
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+}
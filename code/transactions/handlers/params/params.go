@@ -0,0 +1,20 @@
+package params
+
+import "time"
+
+// Time lê um instante em RFC 3339 ou uma data (AAAA-MM-DD, em UTC);
+// com endOfDay a data vale até o último instante do dia
+func Time(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestAccountUpdateBlockCloseAndRestore(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+
+	admin := func(method, url, ifMatch, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Admin-Token", "admin")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	buy := func(from, to *models.Account, amount string) models.AuthorizationResponse {
+		_, auth := purchase(t, router, login(t, router, from.CPF),
+			fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "Loja", "mcc": ""}`, to.ID, amount))
+		return auth
+	}
+	account := fmt.Sprintf("/accounts/%d", origem.ID)
+
+	// alteração com concorrência otimista
+	rr := admin("GET", account, "", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Errorf("Expected ETag \"1\". Got %s", etag)
+	}
+
+	rr = admin("PATCH", account, "", `{"cash_fallback": true}`)
+	checkResponseCode(t, http.StatusPreconditionRequired, rr.Code)
+	rr = admin("PATCH", account, etag, `{"cash_fallback": true}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var a models.Account
+	json.Unmarshal(rr.Body.Bytes(), &a)
+	if !a.Cash_fallback || a.Version != 2 || rr.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected cash fallback at version 2. Got %+v", a)
+	}
+	rr = admin("PATCH", account, etag, `{"cash_fallback": false}`)
+	checkResponseCode(t, http.StatusPreconditionFailed, rr.Code)
+
+	// conta bloqueada recusa as compras
+	rr = admin("POST", account+"/block", "", "")
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	rr = admin("POST", account+"/block", "", `{"reason": "contestação do titular"}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if auth := buy(origem, destino, "10"); auth.Code != models.CodeNotPermitted || auth.Reason != models.ReasonAccountBlocked {
+		t.Errorf("Expected account blocked. Got %+v", auth)
+	}
+	rr = admin("POST", account+"/block", "", `{"reason": "de novo"}`)
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+
+	rr = admin("POST", account+"/unblock", "", `{"reason": "contestação resolvida"}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	// o encerramento exige as carteiras zeradas
+	rr = admin("DELETE", account, "", "")
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+	if auth := buy(origem, destino, "100"); !auth.Approved {
+		t.Errorf("Expected approved purchase. Got %+v", auth)
+	}
+	rr = admin("DELETE", account, "", `{"reason": "pedido do titular"}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	a = models.Account{}
+	json.Unmarshal(rr.Body.Bytes(), &a)
+	if a.Status != models.AccountClosed || a.Closed_at == nil {
+		t.Errorf("Expected closed account. Got %+v", a)
+	}
+
+	// conta encerrada não compra nem recebe
+	if auth := buy(origem, destino, "1"); auth.Code != models.CodeInvalidAccount || auth.Reason != models.ReasonAccountClosed {
+		t.Errorf("Expected account closed. Got %+v", auth)
+	}
+	if auth := buy(destino, origem, "1"); auth.Code != models.CodeInvalidAccount || auth.Reason != models.ReasonInvalidDestination {
+		t.Errorf("Expected invalid destination. Got %+v", auth)
+	}
+	rr = admin("PATCH", account, "*", `{"cash_fallback": false}`)
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+
+	rr = admin("POST", account+"/restore", "", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	a = models.Account{}
+	json.Unmarshal(rr.Body.Bytes(), &a)
+	if a.Status != models.AccountActive || a.Closed_at != nil {
+		t.Errorf("Expected active account. Got %+v", a)
+	}
+}
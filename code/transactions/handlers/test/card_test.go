@@ -0,0 +1,99 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/luhn"
+	"cajueiro/pkg/money"
+)
+
+func TestCardLifecycleAndAuthorization(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	request := func(method, url, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	buy := func(card string) models.AuthorizationResponse {
+		_, auth := purchase(t, router, token,
+			fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 5, "merchant": "Padaria %s", "mcc": "", "card_token": "%s"}`, destino.ID, card, card))
+		return auth
+	}
+
+	// emissão, com o PAN completo apenas na resposta
+	rr := request("POST", fmt.Sprintf("/accounts/%d/cards", origem.ID), "")
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var card models.Card
+	json.Unmarshal(rr.Body.Bytes(), &card)
+	if !luhn.Valid(card.Pan) || card.Status != models.CardActive || card.Masked_pan[12:] != card.Pan[12:] {
+		t.Fatalf("Expected an active card with a valid PAN. Got %+v", card)
+	}
+	cardURL := fmt.Sprintf("/accounts/%d/cards/%s", origem.ID, card.Token)
+
+	if auth := buy(card.Token.String()); !auth.Approved {
+		t.Errorf("Expected approved purchase. Got %+v", auth)
+	}
+
+	// cartão bloqueado
+	rr = request("POST", cardURL+"/block", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if auth := buy(card.Token.String()); auth.Code != models.CodeCardBlocked || auth.Reason != models.ReasonCardBlocked {
+		t.Errorf("Expected blocked card decline. Got %+v", auth)
+	}
+
+	rr = request("POST", cardURL+"/unblock", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	// cartão vencido
+	api.DB.Client.Model(&models.Card{}).Where("token = ?", card.Token).Update("expires_at", time.Now().Add(-time.Minute))
+	if auth := buy(card.Token.String()); auth.Code != models.CodeCardExpired || auth.Reason != models.ReasonCardExpired {
+		t.Errorf("Expected expired card decline. Got %+v", auth)
+	}
+
+	// cartão cancelado não volta a ser desbloqueado
+	rr = request("POST", cardURL+"/cancel", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	rr = request("POST", cardURL+"/unblock", "")
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+	if auth := buy(card.Token.String()); auth.Reason != models.ReasonCardCanceled {
+		t.Errorf("Expected canceled card decline. Got %+v", auth)
+	}
+
+	// cartão de outra conta
+	rr = request("POST", fmt.Sprintf("/accounts/%d/cards", destino.ID), "")
+	checkResponseCode(t, http.StatusForbidden, rr.Code)
+	other, err := models.IssueCard(api, destino.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth := buy(other.Token.String()); auth.Reason != models.ReasonInvalidCard {
+		t.Errorf("Expected invalid card decline. Got %+v", auth)
+	}
+
+	// conta bloqueada não recebe cartão
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/accounts/%d/block", origem.ID), bytes.NewBufferString(`{"reason": "contestação do titular"}`))
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	rr = request("POST", fmt.Sprintf("/accounts/%d/cards", origem.ID), "")
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+}
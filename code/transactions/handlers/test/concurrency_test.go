@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// getTestApp conecta no banco definido pelas variáveis de ambiente POSTGRES_*
+// e ignora o teste quando não houver banco disponível
+func getTestApp(t *testing.T) *app.App {
+	viper.AutomaticEnv()
+	viper.SetDefault("TOKEN_KEY", "gophers")
+	viper.SetDefault("AUTH_TIMEOUT_MS", 10000)
+	viper.SetDefault("ADMIN_TOKEN", "admin")
+	viper.SetDefault("PAN_HASH_KEY", "cajueiro")
+
+	if viper.GetString("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST não definido, teste de integração ignorado")
+	}
+
+	api, err := app.GetApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.Migrate(api.DB.Client); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.LoadMccCategories(api); err != nil {
+		t.Fatal(err)
+	}
+
+	// limita o pool para forçar a disputa pelas conexões
+	sqlDB, err := api.DB.Client.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(20)
+
+	return api
+}
+
+// createTestAccount cria uma conta com CPF aleatório e o saldo de cash informado
+func createTestAccount(t *testing.T, api *app.App, cash money.Money) *models.Account {
+	a := &models.Account{
+		CPF:     fmt.Sprintf("%011d", rand.Int63n(1e11)),
+		Secret:  "123456",
+		Wallets: []models.Wallet{{Category: models.WalletCash, Balance: cash}},
+	}
+
+	account, err := a.CreateAccount(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return account
+}
+
+// login retorna o token JWT da conta
+func login(t *testing.T, router *mux.Router, cpf string) string {
+	payload, _ := json.Marshal(map[string]string{"cpf": cpf, "secret": "123456"})
+
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var m map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &m)
+
+	return m["token"]
+}
+
+// purchase envia a autorização do payload com o token da conta de origem e
+// falha o teste se a resposta não for uma autorização
+func purchase(t *testing.T, router *mux.Router, token, payload string) (*httptest.ResponseRecorder, models.AuthorizationResponse) {
+	req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+	req.Header.Set("Token", token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var auth models.AuthorizationResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &auth); err != nil {
+		t.Fatalf("Expected authorization response. Got %d %s: %v", rr.Code, rr.Body.String(), err)
+	}
+	return rr, auth
+}
+
+func TestConcurrentTransactionsDoNotOverdraw(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	rand.Seed(time.Now().UnixNano())
+
+	router := routers.GetRouter(api)
+
+	const (
+		balance  = 100
+		requests = 300
+	)
+
+	origem := createTestAccount(t, api, money.FromCents(balance*100))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	payload := []byte(fmt.Sprintf(`{
+		"accounttocredit_id": %d,
+		"amount": 1,
+		"merchant": "Mercantil Dourado",
+		"mcc": ""
+	}`, destino.ID))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		approved int
+	)
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, _ := http.NewRequest("POST", "/transactions", bytes.NewBuffer(payload))
+			req.Header.Set("Token", token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var m map[string]interface{}
+			json.Unmarshal(rr.Body.Bytes(), &m)
+
+			if m["code"] == models.CodeApproved {
+				mu.Lock()
+				approved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if approved != balance {
+		t.Errorf("Expected %d approved transactions. Got %d", balance, approved)
+	}
+
+	wallet := &models.Wallet{}
+	if err := api.DB.Client.First(&wallet, "account_id = ? AND category = ?", origem.ID, models.WalletCash); err.Error != nil {
+		t.Fatal(err.Error)
+	}
+
+	if wallet.Balance != 0 {
+		t.Errorf("Expected final cash balance 0. Got %v", wallet.Balance)
+	}
+}
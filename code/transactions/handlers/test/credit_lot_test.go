@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestExpiringCreditsAreConsumedFirstAndExpire(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	e := &models.Employer{Name: "Cajueiro Ltda", CNPJ: fmt.Sprintf("%014d", rand.Int63n(1e14))}
+	employer, err := e.CreateEmployer(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origem := createTestAccount(t, api, 0)
+	destino := createTestAccount(t, api, 0)
+	if err := employer.LinkAccount(api, origem.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// um crédito que vence em 2099 e outro que vence amanhã
+	tomorrow := time.Now().In(api.Cfg.GetLocation()).AddDate(0, 0, 1).Format("2006-01-02")
+	for _, line := range []string{"100.00,2099-12-31", "50.00," + tomorrow} {
+		file := fmt.Sprintf("cpf,wallet,amount,expires_at\n%s,food,%s\n", origem.CPF, line)
+		batch, err := models.CreatePayrollBatch(api, employer, "csv", models.PayrollAtomic, []byte(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch, err = models.ProcessPayrollBatch(api, batch.ID); err != nil || batch.Status != models.PayrollCompleted {
+			t.Fatalf("Expected completed batch. Got %v %v", batch, err)
+		}
+	}
+
+	// a compra consome primeiro o crédito que vence amanhã
+	token := login(t, router, origem.CPF)
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 70, "merchant": "Mercado", "mcc": "5411"}`, destino.ID)
+	req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+	req.Header.Set("Token", token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var purchase models.AuthorizationResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &purchase); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/accounts/%d/balance", origem.ID), nil)
+	req.Header.Set("Token", token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var balances map[string]models.WalletBalance
+	json.Unmarshal(rr.Body.Bytes(), &balances)
+	food := balances[models.WalletFood]
+	if food.Balance != money.FromCents(8000) {
+		t.Errorf("Expected food balance 80.00. Got %v", food.Balance)
+	}
+	if len(food.Expiring) != 1 || food.Expiring[0].Date != "2099-12-31" || food.Expiring[0].Amount != money.FromCents(8000) {
+		t.Errorf("Expected 80.00 expiring on 2099-12-31. Got %+v", food.Expiring)
+	}
+
+	// o estorno devolve primeiro ao crédito que vence depois e mantém a validade
+	req, _ = http.NewRequest("POST", "/transactions/"+purchase.Transaction_id.String()+"/reversal", bytes.NewBufferString(`{"amount": 30}`))
+	req.Header.Set("Token", login(t, router, destino.CPF))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/accounts/%d/balance", origem.ID), nil)
+	req.Header.Set("Token", token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	balances = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &balances); err != nil {
+		t.Fatal(err)
+	}
+	food = balances[models.WalletFood]
+	expected := []models.ExpiringAmount{{Date: tomorrow, Amount: money.FromCents(1000)}, {Date: "2099-12-31", Amount: money.FromCents(10000)}}
+	if food.Balance != money.FromCents(11000) || len(food.Expiring) != 2 || food.Expiring[0] != expected[0] || food.Expiring[1] != expected[1] {
+		t.Errorf("Expected 110.00 with %+v expiring. Got %v with %+v", expected, food.Balance, food.Expiring)
+	}
+
+	// vencido, o que sobrou do crédito é expirado
+	if err := api.DB.Client.Model(&models.CreditLot{}).
+		Where("account_id = ? AND status = ?", origem.ID, models.LotActive).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.ExpireCredits(api); err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := &models.Wallet{}
+	if err := api.DB.Client.First(wallet, "account_id = ? AND category = ?", origem.ID, models.WalletFood).Error; err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != 0 {
+		t.Errorf("Expected food balance 0.00 after expiry. Got %v", wallet.Balance)
+	}
+
+	check, err := models.CheckLedger(api.DB.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Consistent {
+		t.Errorf("Expected consistent ledger. Got %+v", check)
+	}
+}
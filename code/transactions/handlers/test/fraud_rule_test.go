@@ -0,0 +1,76 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestFraudRulesDeclineAndRecord(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	admin := func(method, url, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Admin-Token", "admin")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// regra desconhecida
+	rr := admin("POST", "/admin/fraud-rules", `{"name": "desconhecida", "action": "decline", "enabled": true}`)
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+	rr = admin("POST", "/admin/fraud-rules", fmt.Sprintf(`{"name": "%s", "action": "decline", "enabled": true, "window": 2}`, models.RuleRepeatedPurchase))
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var rule models.FraudRule
+	json.Unmarshal(rr.Body.Bytes(), &rule)
+	defer admin("DELETE", fmt.Sprintf("/admin/fraud-rules/%d", rule.ID), "")
+
+	origem := createTestAccount(t, api, money.FromCents(100000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 42.50, "merchant": "Posto Cajueiro", "mcc": ""}`, destino.ID)
+
+	rr, first := purchase(t, router, token, payload)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	// mesmo estabelecimento e valor dentro de 2 minutos
+	rr, second := purchase(t, router, token, payload)
+	checkResponseCode(t, http.StatusPaymentRequired, rr.Code)
+	if second.Code != models.CodeSuspectedFraud || second.Reason != models.ReasonSuspectedFraud {
+		t.Errorf("Expected suspected fraud. Got %+v", second)
+	}
+
+	// a regra disparada fica registrada com a transação
+	var triggered []models.TriggeredRule
+	api.DB.Client.Where("transaction_id = ? AND rule_id = ?", second.Transaction_id, rule.ID).Find(&triggered)
+	if len(triggered) != 1 || triggered[0].Action != models.FraudDecline {
+		t.Errorf("Expected triggered rule recorded. Got %+v", triggered)
+	}
+	api.DB.Client.Where("transaction_id = ? AND rule_id = ?", first.Transaction_id, rule.ID).Find(&triggered)
+	if len(triggered) != 0 {
+		t.Errorf("Expected no triggered rule on first purchase. Got %+v", triggered)
+	}
+
+	// com a ação flag a compra é aprovada e marcada
+	rr = admin("PUT", fmt.Sprintf("/admin/fraud-rules/%d", rule.ID), fmt.Sprintf(`{"name": "%s", "action": "flag", "enabled": true, "window": 2}`, models.RuleRepeatedPurchase))
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	rr, third := purchase(t, router, token, payload)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if !third.Flagged {
+		t.Errorf("Expected flagged purchase. Got %+v", third)
+	}
+}
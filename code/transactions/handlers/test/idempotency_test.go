@@ -0,0 +1,107 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestIdempotentTransactionRetry(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	post := func(payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		req.Header.Set("Idempotency-Key", fmt.Sprintf("retry-%d", origem.ID))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 10, "merchant": "Padaria", "mcc": ""}`, destino.ID)
+
+	first := post(payload)
+	second := post(payload)
+
+	checkResponseCode(t, first.Code, second.Code)
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Expected replayed body %s. Got %s", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected Idempotent-Replayed header on retry")
+	}
+
+	var count int64
+	api.DB.Client.Model(&models.Transaction{}).Where("account_id = ?", origem.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 transaction. Got %d", count)
+	}
+
+	other := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 20, "merchant": "Padaria", "mcc": ""}`, destino.ID)
+	checkResponseCode(t, http.StatusConflict, post(other).Code)
+}
+
+func TestIdempotentRetryAfterAbandonedKey(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+	key := fmt.Sprintf("abandoned-%d", origem.ID)
+
+	post := func(payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 10, "merchant": "Padaria", "mcc": ""}`, destino.ID)
+	first := post(payload)
+	checkResponseCode(t, http.StatusCreated, first.Code)
+
+	// simula o request que gravou a transação e caiu antes de armazenar a resposta
+	api.DB.Client.Model(&models.IdempotencyKey{}).
+		Where("account_id = ? AND key = ?", origem.ID, key).
+		Updates(map[string]interface{}{"status_code": 0, "response": nil, "updated_at": time.Now().Add(-2 * time.Minute)})
+
+	second := post(payload)
+	checkResponseCode(t, http.StatusCreated, second.Code)
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected Idempotent-Replayed header on retry")
+	}
+
+	// a resposta vem da transação gravada, não de uma nova autorização
+	var a, b models.AuthorizationResponse
+	json.Unmarshal(first.Body.Bytes(), &a)
+	json.Unmarshal(second.Body.Bytes(), &b)
+	if a.Transaction_id != b.Transaction_id || !b.Approved {
+		t.Errorf("Expected replayed authorization %+v. Got %+v", a, b)
+	}
+
+	var count int64
+	api.DB.Client.Model(&models.Transaction{}).Where("account_id = ?", origem.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 transaction. Got %d", count)
+	}
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/handlers/iso"
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/iso8583"
+	"cajueiro/pkg/money"
+)
+
+func TestISORetransmissionIsIdempotent(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/accounts/%d/cards", origem.ID), bytes.NewBufferString(""))
+	req.Header.Set("Token", token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var card models.Card
+	json.Unmarshal(rr.Body.Bytes(), &card)
+
+	message := func(amount string) *iso8583.Message {
+		m := iso8583.NewMessage("0200")
+		m.Set(2, card.Pan)
+		m.Set(4, amount)
+		m.Set(11, "000123")
+		m.Set(18, "5411")
+		m.Set(37, fmt.Sprintf("%012d", origem.ID))
+		m.Set(42, fmt.Sprintf("%-15d", destino.ID))
+		m.Set(43, fmt.Sprintf("%-40s", "PADARIA"))
+		return m
+	}
+
+	authorize := iso.Authorize(api)
+	first := authorize(message("1000"))
+	second := authorize(message("1000"))
+
+	if first.Get(39) != models.CodeApproved {
+		t.Fatalf("Expected approved authorization. Got %s", first.Get(39))
+	}
+	if second.Get(39) != first.Get(39) || second.Get(38) != first.Get(38) {
+		t.Errorf("Expected replayed response %v. Got %v", first.Fields, second.Fields)
+	}
+
+	var count int64
+	api.DB.Client.Model(&models.Transaction{}).Where("account_id = ?", origem.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 transaction. Got %d", count)
+	}
+
+	// mesmo RRN e STAN com outro valor
+	if got := authorize(message("2000")).Get(39); got != models.CodeDuplicate {
+		t.Errorf("Expected duplicate transmission code %s. Got %s", models.CodeDuplicate, got)
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestLedgerPostingsBalance(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 25, "merchant": "Padaria", "mcc": ""}`, destino.ID)
+	req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+	req.Header.Set("Token", token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+
+	// o destino é creditado, não debitado
+	wallet := &models.Wallet{}
+	if err := api.DB.Client.First(&wallet, "account_id = ? AND category = ?", destino.ID, models.WalletCash); err.Error != nil {
+		t.Fatal(err.Error)
+	}
+	if wallet.Balance != money.FromCents(2500) {
+		t.Errorf("Expected destination cash balance 25.00. Got %v", wallet.Balance)
+	}
+
+	var entries []models.LedgerEntry
+	api.DB.Client.Where("transaction_id = ?", m["transaction_id"]).Order("id").Find(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 postings. Got %d", len(entries))
+	}
+	if entries[0].Amount+entries[1].Amount != 0 {
+		t.Errorf("Expected postings to sum to zero. Got %v and %v", entries[0].Amount, entries[1].Amount)
+	}
+
+	// lançamentos não podem ser alterados
+	if err := api.DB.Client.Model(&entries[0]).Update("amount", 0).Error; err == nil {
+		t.Errorf("Expected ledger_entries to reject updates")
+	}
+
+	check, err := models.CheckLedger(api.DB.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Consistent {
+		t.Errorf("Expected consistent ledger. Got %+v", check)
+	}
+}
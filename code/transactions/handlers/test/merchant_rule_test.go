@@ -0,0 +1,68 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestMerchantRulePatternsFollowRegistryChanges(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	admin := func(method, url, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Admin-Token", "admin")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	merchant := fmt.Sprintf("Loja Teste %d", rand.Int63n(1e9))
+	mcc := func() string {
+		_, auth := purchase(t, router, token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 1, "merchant": "%s", "mcc": ""}`, destino.ID, merchant))
+		return auth.Effective_mcc
+	}
+
+	pattern := "^" + models.NormalizeMerchant(merchant) + "$"
+	rr := admin("POST", "/admin/merchant-rules", fmt.Sprintf(`{"pattern": "%s", "mcc": "5812"}`, pattern))
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var rule models.MerchantRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mcc(); got != "5812" {
+		t.Errorf("Expected effective mcc 5812 from the pattern. Got %s", got)
+	}
+
+	// a alteração do registro vale para a autorização seguinte
+	rr = admin("PUT", fmt.Sprintf("/admin/merchant-rules/%d", rule.ID), fmt.Sprintf(`{"pattern": "%s", "mcc": "5411"}`, pattern))
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if got := mcc(); got != "5411" {
+		t.Errorf("Expected effective mcc 5411 after the update. Got %s", got)
+	}
+
+	rr = admin("DELETE", fmt.Sprintf("/admin/merchant-rules/%d", rule.ID), "")
+	checkResponseCode(t, http.StatusNoContent, rr.Code)
+	if got := mcc(); got != "" {
+		t.Errorf("Expected no effective mcc after the delete. Got %s", got)
+	}
+
+	rr = admin("DELETE", fmt.Sprintf("/admin/merchant-rules/%d", rule.ID), "")
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestMerchantsPopulatedAndSearched(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	// nome único por execução, com acento e pontuação
+	name := fmt.Sprintf("Padaria São Jorge %d", rand.Int63n(1e9))
+	for _, amount := range []string{"10", "15.50"} {
+		payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "%s", "mcc": ""}`, destino.ID, amount, name)
+		req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	}
+
+	// busca por trecho do nome, sem acento e com erro de digitação
+	search := func(q string) []models.MerchantSummary {
+		req, _ := http.NewRequest("GET", "/merchants?q="+url.QueryEscape(q), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var merchants []models.MerchantSummary
+		json.Unmarshal(rr.Body.Bytes(), &merchants)
+		return merchants
+	}
+
+	normalized := models.NormalizeMerchant(name)
+	var found *models.MerchantSummary
+	for _, q := range []string{name, "padaria sao jorge", normalized[:len(normalized)-1] + "x"} {
+		found = nil
+		merchants := search(q)
+		for i := range merchants {
+			if merchants[i].Normalized == normalized {
+				found = &merchants[i]
+			}
+		}
+		if found == nil {
+			t.Fatalf("Expected %q in search for %q", normalized, q)
+		}
+	}
+	if found.Transactions != 2 || found.Volume != money.FromCents(2550) {
+		t.Errorf("Expected 2 transactions and 25.50 volume. Got %d %v", found.Transactions, found.Volume)
+	}
+
+	// o cadastro só é alterado com o token administrativo
+	payload := fmt.Sprintf(`{"name": "%s", "cnpj": "12345678000199", "city": "Recife"}`, name)
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/merchants/%d", found.ID), bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/merchants/%d", found.ID), bytes.NewBufferString(payload))
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var merchant models.Merchant
+	json.Unmarshal(rr.Body.Bytes(), &merchant)
+	if merchant.CNPJ != "12345678000199" || merchant.City != "Recife" || merchant.Status != models.MerchantActive {
+		t.Errorf("Expected updated merchant. Got %+v", merchant)
+	}
+
+	// o mesmo nome normalizado não é cadastrado duas vezes
+	req, _ = http.NewRequest("POST", "/merchants", bytes.NewBufferString(fmt.Sprintf(`{"name": "%s"}`, normalized)))
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestPayrollBatchValidatesAndCreditsOnce(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	e := &models.Employer{Name: "Cajueiro Ltda", CNPJ: fmt.Sprintf("%014d", rand.Int63n(1e14))}
+	employer, err := e.CreateEmployer(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := createTestAccount(t, api, 0)
+	second := createTestAccount(t, api, 0)
+	unlinked := createTestAccount(t, api, 0)
+	for _, a := range []*models.Account{first, second} {
+		if err := employer.LinkAccount(api, a.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := fmt.Sprintf("cpf;wallet;amount\n%s;food;800,00\n%s;meal;600,00\n%s;food;800,00\n",
+		first.CPF, second.CPF, unlinked.CPF)
+
+	post := func(path, body string) (*httptest.ResponseRecorder, models.PayrollBatch) {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Admin-Token", "admin")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var batch models.PayrollBatch
+		json.Unmarshal(rr.Body.Bytes(), &batch)
+		return rr, batch
+	}
+
+	balance := func(a *models.Account, category string) money.Money {
+		w := &models.Wallet{}
+		if err := api.DB.Client.First(w, "account_id = ? AND category = ?", a.ID, category).Error; err != nil {
+			t.Fatal(err)
+		}
+		return w.Balance
+	}
+
+	// no modo atômico a conta não vinculada rejeita o lote inteiro
+	rr, batch := post(fmt.Sprintf("/admin/employers/%d/payroll", employer.ID), file)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	if batch.Status != models.PayrollRejected || batch.Lines[2].Error == "" {
+		t.Errorf("Expected rejected batch with error on line 4. Got %+v", batch)
+	}
+	if balance(first, models.WalletFood) != 0 {
+		t.Errorf("Expected no credit from a rejected batch")
+	}
+
+	// no modo por linha as linhas válidas são creditadas
+	rr, batch = post(fmt.Sprintf("/admin/employers/%d/payroll?mode=per_line", employer.ID), file)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if batch.Status != models.PayrollCompleted || batch.Summary[models.LineCredited] != 2 || batch.Summary[models.LineInvalid] != 1 {
+		t.Errorf("Expected completed batch with 2 credited and 1 invalid lines. Got %s %v", batch.Status, batch.Summary)
+	}
+
+	// o mesmo arquivo não é importado de novo
+	rr, _ = post(fmt.Sprintf("/admin/employers/%d/payroll?mode=per_line", employer.ID), file)
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+
+	// retomar um lote concluído não credita de novo
+	rr, _ = post(fmt.Sprintf("/admin/payroll/%s/resume", batch.ID), "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	if balance(first, models.WalletFood) != money.FromCents(80000) || balance(second, models.WalletMeal) != money.FromCents(60000) {
+		t.Errorf("Expected food 800.00 and meal 600.00. Got %v and %v",
+			balance(first, models.WalletFood), balance(second, models.WalletMeal))
+	}
+
+	// a linha de uma conta encerrada é inválida
+	closed := createTestAccount(t, api, 0)
+	if err := employer.LinkAccount(api, closed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.CloseAccount(api, closed.ID, "pedido do titular"); err != nil {
+		t.Fatal(err)
+	}
+	_, batch = post(fmt.Sprintf("/admin/employers/%d/payroll?mode=per_line", employer.ID),
+		fmt.Sprintf("cpf;wallet;amount\n%s;food;800,00\n%s;food;100,00\n", closed.CPF, first.CPF))
+	if len(batch.Lines) != 2 || batch.Lines[0].Status != models.LineInvalid || batch.Lines[0].Error != "Conta encerrada" {
+		t.Errorf("Expected invalid line for the closed account. Got %+v", batch.Lines)
+	}
+	if balance(closed, models.WalletFood) != 0 {
+		t.Errorf("Expected no credit to the closed account. Got %v", balance(closed, models.WalletFood))
+	}
+}
+
+func TestConcurrentPayrollImportsCreateOneBatch(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	e := &models.Employer{Name: "Cajueiro Ltda", CNPJ: fmt.Sprintf("%014d", rand.Int63n(1e14))}
+	employer, err := e.CreateEmployer(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := createTestAccount(t, api, 0)
+	if err := employer.LinkAccount(api, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	file := []byte(fmt.Sprintf("cpf;wallet;amount\n%s;food;800,00\n", a.CPF))
+
+	// o mesmo arquivo importado ao mesmo tempo gera um único lote
+	const imports = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, imports)
+	for i := 0; i < imports; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := models.CreatePayrollBatch(api, employer, "csv", models.PayrollAtomic, file)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else if _, ok := err.(*models.ErrPayrollDuplicate); !ok {
+			t.Errorf("Expected duplicate error. Got %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 batch created. Got %d", created)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestPreauthCaptureAndVoid(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+	merchant := login(t, router, destino.CPF)
+
+	post := func(path, payload string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		// captura e cancelamento são feitos pelo estabelecimento
+		if path != "/transactions" {
+			req.Header.Set("Token", merchant)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var m map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &m)
+		return rr, m
+	}
+
+	cash := func() *models.Wallet {
+		wallet := &models.Wallet{}
+		if err := api.DB.Client.First(&wallet, "account_id = ? AND category = ?", origem.ID, models.WalletCash); err.Error != nil {
+			t.Fatal(err.Error)
+		}
+		return wallet
+	}
+
+	// pré-autorização bloqueia o saldo disponível, não o contábil
+	rr, preauth := post("/transactions", fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 60, "merchant": "Hotel", "mcc": "", "type": "preauth"}`, destino.ID))
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	if w := cash(); w.Balance != money.FromCents(10000) || w.Held != money.FromCents(6000) {
+		t.Errorf("Expected balance 100.00 held 60.00. Got %v held %v", w.Balance, w.Held)
+	}
+
+	rr, _ = post("/transactions", fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 50, "merchant": "Padaria", "mcc": ""}`, destino.ID))
+	checkResponseCode(t, http.StatusPaymentRequired, rr.Code)
+
+	// a conta de origem não captura nem cancela a própria pré-autorização
+	id := preauth["transaction_id"].(string)
+	for _, action := range []string{"capture", "void"} {
+		req, _ := http.NewRequest("POST", "/transactions/"+id+"/"+action, nil)
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	}
+
+	// captura parcial libera o restante do bloqueio
+	rr, capture := post("/transactions/"+id+"/capture", `{"amount": 45}`)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if capture["type"] != models.TypeCapture || capture["parent_id"] != id {
+		t.Errorf("Expected capture linked to %s. Got %s", id, rr.Body.String())
+	}
+
+	if w := cash(); w.Balance != money.FromCents(5500) || w.Held != 0 {
+		t.Errorf("Expected balance 55.00 held 0.00. Got %v held %v", w.Balance, w.Held)
+	}
+
+	rr, _ = post("/transactions/"+id+"/capture", "")
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+	rr, _ = post("/transactions/"+id+"/void", "")
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+
+	// cancelamento devolve todo o saldo disponível
+	_, preauth = post("/transactions", fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 20, "merchant": "Posto", "mcc": "", "type": "preauth"}`, destino.ID))
+	id = preauth["transaction_id"].(string)
+
+	rr, _ = post("/transactions/"+id+"/capture", `{"amount": 25}`)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// o operador cancela com o token administrativo
+	req, _ := http.NewRequest("POST", "/transactions/"+id+"/void", nil)
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	if w := cash(); w.Balance != money.FromCents(5500) || w.Held != 0 {
+		t.Errorf("Expected balance 55.00 held 0.00. Got %v held %v", w.Balance, w.Held)
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestReversalRefundsDebitedWallet(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	outra := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+	merchant := login(t, router, destino.CPF)
+
+	post := func(path, token, payload, key string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var m map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &m)
+		return rr, m
+	}
+
+	cash := func() money.Money {
+		wallet := &models.Wallet{}
+		if err := api.DB.Client.First(&wallet, "account_id = ? AND category = ?", origem.ID, models.WalletCash); err.Error != nil {
+			t.Fatal(err.Error)
+		}
+		return wallet.Balance
+	}
+
+	_, purchase := post("/transactions", token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 30, "merchant": "Padaria", "mcc": ""}`, destino.ID), "")
+	id := purchase["transaction_id"].(string)
+
+	// a conta de origem não estorna a própria compra
+	rr, _ := post("/transactions/"+id+"/reversal", token, `{"amount": 10}`, "")
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	// estorno parcial repetido com a mesma chave devolve o valor uma vez
+	key := fmt.Sprintf("reversal-%d", origem.ID)
+	first, reversal := post("/transactions/"+id+"/reversal", merchant, `{"amount": 10}`, key)
+	second, _ := post("/transactions/"+id+"/reversal", merchant, `{"amount": 10}`, key)
+
+	checkResponseCode(t, http.StatusCreated, first.Code)
+	checkResponseCode(t, http.StatusCreated, second.Code)
+	if reversal["type"] != models.TypeReversal || reversal["parent_id"] != id || reversal["wallet"] != models.WalletCash {
+		t.Errorf("Expected cash reversal linked to %s. Got %s", id, first.Body.String())
+	}
+	if got := cash(); got != money.FromCents(8000) {
+		t.Errorf("Expected cash balance 80.00. Got %v", got)
+	}
+
+	// estorno acima do restante é recusado
+	rr, _ = post("/transactions/"+id+"/reversal", merchant, `{"amount": 25}`, "")
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// sem valor estorna o restante
+	rr, _ = post("/transactions/"+id+"/reversal", merchant, "", "")
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if got := cash(); got != money.FromCents(10000) {
+		t.Errorf("Expected cash balance 100.00. Got %v", got)
+	}
+
+	rr, _ = post("/transactions/"+id+"/reversal", merchant, "", "")
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// estabelecimento sem saldo disponível para devolver não estorna
+	_, purchase = post("/transactions", token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 30, "merchant": "Padaria", "mcc": ""}`, destino.ID), "")
+	rr, _ = post("/transactions", merchant, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 25, "merchant": "Atacado", "mcc": ""}`, outra.ID), "")
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	rr, _ = post("/transactions/"+purchase["transaction_id"].(string)+"/reversal", merchant, "", "")
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	if got := cash(); got != money.FromCents(7000) {
+		t.Errorf("Expected cash balance 70.00. Got %v", got)
+	}
+
+	// os estornos aparecem como linhas próprias na listagem
+	req, _ := http.NewRequest("GET", "/transactions", nil)
+	req.Header.Set("Token", token)
+	list := httptest.NewRecorder()
+	router.ServeHTTP(list, req)
+
+	checkResponseCode(t, http.StatusOK, list.Code)
+	var page models.TransactionPage
+	if err := json.Unmarshal(list.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Expected transaction page. Got %s: %v", list.Body.String(), err)
+	}
+
+	reversals := 0
+	for _, tr := range page.Transactions {
+		if tr.Type == models.TypeReversal {
+			reversals++
+		}
+	}
+	if reversals != 2 {
+		t.Errorf("Expected 2 reversal rows. Got %d", reversals)
+	}
+}
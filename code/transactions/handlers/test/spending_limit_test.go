@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestSpendingLimitsDeclineBeforeBalance(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(100000))
+	destino := createTestAccount(t, api, 0)
+	outra := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	request := func(method, url, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	admin := func(method, url, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Admin-Token", "admin")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	buy := func(amount string) models.AuthorizationResponse {
+		_, auth := purchase(t, router, token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "Loja", "mcc": ""}`, destino.ID, amount))
+		return auth
+	}
+
+	// só o operador altera os limites, nem o dono da conta
+	rr := request("PUT", fmt.Sprintf("/accounts/%d/limits/cash", origem.ID), `{"daily": 10}`)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	rr = request("DELETE", fmt.Sprintf("/accounts/%d/limits/cash", origem.ID), "")
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	rr = admin("PUT", "/accounts/0/limits/cash", `{"daily": 10}`)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	rr = admin("PUT", fmt.Sprintf("/accounts/%d/limits/cash", origem.ID), `{"per_transaction": 200, "daily": 300}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	// só o dono da conta consulta os limites
+	rr = request("GET", fmt.Sprintf("/accounts/%d/limits", outra.ID), "")
+	checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+	// acima do limite por transação
+	if auth := buy("250"); auth.Code != models.CodeLimitExceeded || auth.Reason != models.ReasonLimitExceeded {
+		t.Errorf("Expected limit exceeded. Got %+v", auth)
+	}
+
+	// o limite diário soma as compras aprovadas no dia
+	if auth := buy("200"); !auth.Approved {
+		t.Errorf("Expected approved purchase. Got %+v", auth)
+	}
+	if auth := buy("150"); auth.Code != models.CodeLimitExceeded {
+		t.Errorf("Expected daily limit exceeded. Got %+v", auth)
+	}
+
+	// o limite é verificado antes do saldo
+	if auth := buy("5000"); auth.Reason != models.ReasonLimitExceeded {
+		t.Errorf("Expected limit exceeded before insufficient funds. Got %+v", auth)
+	}
+
+	// sem o limite a compra é aprovada
+	rr = admin("DELETE", fmt.Sprintf("/accounts/%d/limits/cash", origem.ID), "")
+	checkResponseCode(t, http.StatusNoContent, rr.Code)
+	if auth := buy("150"); !auth.Approved {
+		t.Errorf("Expected approved purchase. Got %+v", auth)
+	}
+
+	rr = request("GET", fmt.Sprintf("/accounts/%d/limits", origem.ID), "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if body := rr.Body.String(); body != "[]\n" {
+		t.Errorf("Expected no limits. Got %s", body)
+	}
+}
+
+func TestSpendingLimitsNetOutReversals(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(100000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	buy := func(amount string) models.AuthorizationResponse {
+		_, auth := purchase(t, router, token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "Loja", "mcc": ""}`, destino.ID, amount))
+		return auth
+	}
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/accounts/%d/limits/cash", origem.ID), bytes.NewBufferString(`{"daily": 300}`))
+	req.Header.Set("Admin-Token", "admin")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	first := buy("200")
+	if !first.Approved {
+		t.Fatalf("Expected approved purchase. Got %+v", first)
+	}
+	if auth := buy("150"); auth.Code != models.CodeLimitExceeded {
+		t.Errorf("Expected daily limit exceeded. Got %+v", auth)
+	}
+
+	// o estorno parcial devolve o valor ao limite do dia da compra
+	req, _ = http.NewRequest("POST", "/transactions/"+first.Transaction_id.String()+"/reversal", bytes.NewBufferString(`{"amount": 100}`))
+	req.Header.Set("Token", login(t, router, destino.CPF))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	if auth := buy("150"); !auth.Approved {
+		t.Errorf("Expected approved purchase after the reversal. Got %+v", auth)
+	}
+	if auth := buy("100"); auth.Code != models.CodeLimitExceeded {
+		t.Errorf("Expected daily limit exceeded. Got %+v", auth)
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestBalanceAtAndStatement(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	start := time.Now().Add(-time.Second)
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	buy := func(amount string) {
+		rr, _ := purchase(t, router, token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "Padaria", "mcc": ""}`, destino.ID, amount))
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	}
+
+	get := func(path string, v interface{}) {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		json.Unmarshal(rr.Body.Bytes(), v)
+	}
+
+	buy("30")
+	time.Sleep(20 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	buy("20")
+
+	// saldo no instante entre as duas compras
+	var balances map[string]models.WalletBalance
+	get(fmt.Sprintf("/accounts/%d/balance?at=%s", origem.ID, url.QueryEscape(mid.Format(time.RFC3339Nano))), &balances)
+	if balances[models.WalletCash].Balance != money.FromCents(7000) {
+		t.Errorf("Expected cash balance 70.00 at %v. Got %v", mid, balances[models.WalletCash].Balance)
+	}
+
+	// extrato e saldo, atual ou histórico, exigem o token do dono da conta
+	other := login(t, router, destino.CPF)
+	for _, path := range []string{
+		fmt.Sprintf("/accounts/%d/statement", origem.ID),
+		fmt.Sprintf("/accounts/%d/balance", origem.ID),
+		fmt.Sprintf("/accounts/%d/balance?at=%s", origem.ID, url.QueryEscape(mid.Format(time.RFC3339Nano))),
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		req, _ = http.NewRequest("GET", path, nil)
+		req.Header.Set("Token", other)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	}
+
+	var statement models.Statement
+	get(fmt.Sprintf("/accounts/%d/statement?from=%s", origem.ID, url.QueryEscape(start.Format(time.RFC3339Nano))), &statement)
+
+	if statement.Opening[models.WalletCash] != 0 || statement.Closing[models.WalletCash] != money.FromCents(5000) {
+		t.Errorf("Expected opening 0.00 and closing 50.00. Got %v and %v",
+			statement.Opening[models.WalletCash], statement.Closing[models.WalletCash])
+	}
+
+	expected := []money.Money{money.FromCents(10000), money.FromCents(7000), money.FromCents(5000)}
+	if len(statement.Lines) != len(expected) {
+		t.Fatalf("Expected %d statement lines. Got %d", len(expected), len(statement.Lines))
+	}
+	for i, line := range statement.Lines {
+		if line.Wallet != models.WalletCash || line.Balance != expected[i] {
+			t.Errorf("Line %d: expected cash running balance %v. Got %s %v", i, expected[i], line.Wallet, line.Balance)
+		}
+	}
+}
+
+func TestStatementExport(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	token := login(t, router, origem.CPF)
+
+	export := func(query, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/accounts/%d/statement%s", origem.ID, query), nil)
+		req.Header.Set("Token", token)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := export("", "text/csv")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "created,transaction_id") {
+		t.Errorf("Expected CSV header and 1 line. Got %q", rr.Body.String())
+	}
+
+	rr = export("?format=ofx", "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), "<STMTTRN><TRNTYPE>CREDIT") {
+		t.Errorf("Expected OFX credit transaction. Got %q", rr.Body.String())
+	}
+
+	rr = export("", "application/pdf")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" || !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Errorf("Expected PDF document. Got %s", ct)
+	}
+
+	rr = export("?format=xls", "")
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+	// o operador exporta com o token administrativo
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/accounts/%d/statement?format=csv", origem.ID), nil)
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm/clause"
+)
+
+func TestAuthorizationTimeoutDeclines(t *testing.T) {
+	viper.Set("AUTH_TIMEOUT_MS", 50)
+	defer viper.Set("AUTH_TIMEOUT_MS", 10000)
+
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	// outra transação segura a conta de origem além do orçamento
+	lock := api.DB.Client.Begin()
+	lock.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Account{}, origem.ID)
+
+	payload := fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 10, "merchant": "Padaria", "mcc": ""}`, destino.ID)
+	key := fmt.Sprintf("timeout-%d", origem.ID)
+	post := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transactions", bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	rr := post()
+
+	lock.Rollback()
+
+	checkResponseCode(t, http.StatusGatewayTimeout, rr.Code)
+
+	// a chave guarda a recusa por tempo: a repetição não debita de novo
+	retry := post()
+	checkResponseCode(t, http.StatusGatewayTimeout, retry.Code)
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the timeout decline to be replayed. Got %s", retry.Body.String())
+	}
+
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if m["code"] != models.CodeTimeout || m["reason"] != string(models.ReasonTimeout) {
+		t.Errorf("Expected timeout decline. Got %s", rr.Body.String())
+	}
+
+	wallet := &models.Wallet{}
+	if err := api.DB.Client.First(&wallet, "account_id = ? AND category = ?", origem.ID, models.WalletCash); err.Error != nil {
+		t.Fatal(err.Error)
+	}
+	if wallet.Balance != money.FromCents(10000) {
+		t.Errorf("Expected untouched cash balance 100.00. Got %v", wallet.Balance)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/money"
+)
+
+func TestScheduledTopUpsRunOncePerPeriod(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	e := &models.Employer{
+		Name: "Cajueiro Ltda",
+		CNPJ: fmt.Sprintf("%014d", rand.Int63n(1e14)),
+		Schedules: []models.CreditSchedule{
+			{Wallet: models.WalletFood, Amount: money.FromCents(80000)},
+			{Wallet: models.WalletMeal, Amount: money.FromCents(60000), Business_day: 5},
+		},
+	}
+	employer, err := e.CreateEmployer(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := createTestAccount(t, api, 0)
+	closed := createTestAccount(t, api, 0)
+	for _, a := range []*models.Account{account, closed} {
+		if err := employer.LinkAccount(api, a.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := models.CloseAccount(api, closed.ID, "pedido do titular"); err != nil {
+		t.Fatal(err)
+	}
+
+	balance := func(category string) money.Money {
+		w := &models.Wallet{}
+		if err := api.DB.Client.First(w, "account_id = ? AND category = ?", account.ID, category).Error; err != nil {
+			t.Fatal(err)
+		}
+		return w.Balance
+	}
+
+	// 2 de março de 2021 é o segundo dia útil: só o crédito do 1º dia útil é devido
+	now := time.Date(2021, time.March, 2, 12, 0, 0, 0, api.Cfg.GetLocation())
+	for i := 0; i < 2; i++ {
+		if _, err := models.RunTopUps(api, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if balance(models.WalletFood) != money.FromCents(80000) || balance(models.WalletMeal) != 0 {
+		t.Errorf("Expected food 800.00 and meal 0.00. Got %v and %v", balance(models.WalletFood), balance(models.WalletMeal))
+	}
+
+	// a conta encerrada não recebe o crédito
+	var topUps int64
+	if err := api.DB.Client.Model(&models.TopUp{}).Where("account_id = ?", closed.ID).Count(&topUps).Error; err != nil {
+		t.Fatal(err)
+	}
+	if topUps != 0 {
+		t.Errorf("Expected no top-ups for the closed account. Got %d", topUps)
+	}
+
+	// no 5º dia útil o crédito de meal é lançado e o de food não se repete
+	if _, err := models.RunTopUps(api, now.AddDate(0, 0, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if balance(models.WalletFood) != money.FromCents(80000) || balance(models.WalletMeal) != money.FromCents(60000) {
+		t.Errorf("Expected food 800.00 and meal 600.00. Got %v and %v", balance(models.WalletFood), balance(models.WalletMeal))
+	}
+
+	// o mês seguinte é um novo período
+	if _, err := models.RunTopUps(api, now.AddDate(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if balance(models.WalletFood) != money.FromCents(160000) {
+		t.Errorf("Expected food 1600.00 after the next period. Got %v", balance(models.WalletFood))
+	}
+
+	check, err := models.CheckLedger(api.DB.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Consistent {
+		t.Errorf("Expected consistent ledger. Got %+v", check)
+	}
+}
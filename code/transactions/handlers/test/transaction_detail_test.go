@@ -0,0 +1,84 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestTransactionDetailAndAccountTransactions(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	outra := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	request := func(method, url, token, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request("POST", "/transactions", token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": 30, "merchant": "Padaria", "mcc": ""}`, destino.ID))
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var auth models.AuthorizationResponse
+	json.Unmarshal(rr.Body.Bytes(), &auth)
+
+	rr = request("POST", fmt.Sprintf("/transactions/%s/reversal", auth.Transaction_id), login(t, router, destino.CPF), `{"amount": 10}`)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+
+	// a conta de origem e a de destino consultam a transação com o estorno ligado
+	for _, cpf := range []string{origem.CPF, destino.CPF} {
+		rr = request("GET", fmt.Sprintf("/transactions/%s", auth.Transaction_id), login(t, router, cpf), "")
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var detail models.TransactionDetail
+		json.Unmarshal(rr.Body.Bytes(), &detail)
+		if !detail.Approved || detail.Wallet != models.WalletCash || detail.Amount != money.FromCents(3000) {
+			t.Errorf("Expected approved cash purchase of 30.00. Got %+v", detail)
+		}
+		if len(detail.Linked) != 1 || detail.Linked[0].Type != models.TypeReversal || detail.Linked[0].Amount != money.FromCents(1000) {
+			t.Errorf("Expected one linked reversal of 10.00. Got %+v", detail.Linked)
+		}
+	}
+
+	// outra conta não enxerga a transação
+	rr = request("GET", fmt.Sprintf("/transactions/%s", auth.Transaction_id), login(t, router, outra.CPF), "")
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+	rr = request("GET", "/transactions/abc", token, "")
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	// listagem dos operadores, apenas com o token administrativo
+	rr = request("GET", fmt.Sprintf("/accounts/%d/transactions", origem.ID), token, "")
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/accounts/%d/transactions?sort=amount", origem.ID), nil)
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var page models.TransactionPage
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Transactions) != 2 || page.Transactions[0].Type != models.TypeReversal {
+		t.Errorf("Expected the reversal and the purchase. Got %+v", page.Transactions)
+	}
+
+	req, _ = http.NewRequest("GET", "/accounts/0/transactions", nil)
+	req.Header.Set("Admin-Token", "admin")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
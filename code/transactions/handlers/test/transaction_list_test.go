@@ -0,0 +1,94 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"cajueiro/code/transactions/models"
+	"cajueiro/code/transactions/routers"
+	"cajueiro/pkg/money"
+)
+
+func TestListTransactionsFiltersAndCursor(t *testing.T) {
+	api := getTestApp(t)
+	defer api.DB.CloseDB()
+
+	router := routers.GetRouter(api)
+
+	origem := createTestAccount(t, api, money.FromCents(10000))
+	destino := createTestAccount(t, api, 0)
+	token := login(t, router, origem.CPF)
+
+	buy := func(amount, merchant string) {
+		purchase(t, router, token, fmt.Sprintf(`{"accounttocredit_id": %d, "amount": %s, "merchant": "%s", "mcc": ""}`, destino.ID, amount, merchant))
+	}
+	list := func(query url.Values) (*httptest.ResponseRecorder, models.TransactionPage) {
+		req, _ := http.NewRequest("GET", "/transactions?"+query.Encode(), nil)
+		req.Header.Set("Token", token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var page models.TransactionPage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		return rr, page
+	}
+
+	for _, amount := range []string{"10", "20", "30", "40"} {
+		buy(amount, "Padaria")
+	}
+	buy("25", "Farmácia")
+	// recusada por saldo insuficiente
+	buy("500", "Padaria")
+
+	// percorre as páginas de duas transações, da mais recente para a mais antiga
+	var amounts []money.Money
+	query := url.Values{"limit": {"2"}}
+	for pages := 0; pages < 5; pages++ {
+		rr, page := list(query)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		for _, tr := range page.Transactions {
+			amounts = append(amounts, tr.Amount)
+		}
+		if page.Next_cursor == "" {
+			break
+		}
+		query.Set("cursor", page.Next_cursor)
+	}
+	expected := []money.Money{50000, 2500, 4000, 3000, 2000, 1000}
+	if fmt.Sprint(amounts) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v. Got %v", expected, amounts)
+	}
+
+	// aprovadas na padaria entre 15 e 35, da maior para a menor
+	_, page := list(url.Values{"status": {"approved"}, "merchant": {"padaria"}, "min_amount": {"15"}, "max_amount": {"35"}, "sort": {"-amount"}})
+	amounts = nil
+	for _, tr := range page.Transactions {
+		amounts = append(amounts, tr.Amount)
+	}
+	expected = []money.Money{3000, 2000}
+	if fmt.Sprint(amounts) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v. Got %v", expected, amounts)
+	}
+
+	_, page = list(url.Values{"status": {"declined"}})
+	if len(page.Transactions) != 1 || page.Transactions[0].Code != models.CodeInsufficientFunds {
+		t.Errorf("Expected one declined transaction. Got %+v", page.Transactions)
+	}
+
+	// parâmetros inválidos
+	for _, query := range []url.Values{
+		{"sort": {"merchant"}},
+		{"status": {"pending"}},
+		{"cursor": {"x"}},
+		{"min_amount": {"abc"}},
+		{"wallet": {"fuel"}},
+		{"from": {"ontem"}},
+	} {
+		rr, _ := list(query)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"cajueiro/code/transactions/handlers/params"
+	"cajueiro/code/transactions/models"
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+)
+
+// listTransactions escreve a página de transações da conta pedida com os
+// parâmetros da url
+func listTransactions(app *app.App, w http.ResponseWriter, r *http.Request, accountID int) {
+
+	f, err := parseFilter(app, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := models.FindTransactions(app.DB.Client.WithContext(r.Context()), accountID, f)
+	switch err {
+	case nil:
+	case models.ErrInvalidSort, models.ErrInvalidStatus, models.ErrInvalidCursor:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		// caso tenha erro ao procurar no banco retorna 500
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseFilter lê os filtros da listagem de transações dos parâmetros da url
+func parseFilter(app *app.App, query url.Values) (*models.TransactionFilter, error) {
+
+	f := &models.TransactionFilter{
+		Mcc:      query.Get("mcc"),
+		Wallet:   query.Get("wallet"),
+		Status:   query.Get("status"),
+		Merchant: query.Get("merchant"),
+		Sort:     query.Get("sort"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	// período
+	if v := query.Get("from"); v != "" {
+		t, err := params.Time(v, false)
+		if err != nil {
+			return nil, errors.New("Parâmetro from inválido")
+		}
+		f.From = &t
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := params.Time(v, true)
+		if err != nil {
+			return nil, errors.New("Parâmetro to inválido")
+		}
+		f.To = &t
+	}
+	if f.From != nil && f.To != nil && f.From.After(*f.To) {
+		return nil, errors.New("Parâmetro from deve ser anterior a to")
+	}
+
+	if f.Mcc != "" && app.Vld.Var(f.Mcc, "len=4,numeric") != nil {
+		return nil, errors.New("Parâmetro mcc inválido")
+	}
+	if f.Wallet != "" && !app.Cfg.IsWalletCategory(f.Wallet) {
+		return nil, errors.New("Parâmetro wallet inválido")
+	}
+
+	// faixa de valor
+	if v := query.Get("min_amount"); v != "" {
+		amount, err := money.Parse(v)
+		if err != nil {
+			return nil, errors.New("Parâmetro min_amount inválido")
+		}
+		f.Min = &amount
+	}
+	if v := query.Get("max_amount"); v != "" {
+		amount, err := money.Parse(v)
+		if err != nil {
+			return nil, errors.New("Parâmetro max_amount inválido")
+		}
+		f.Max = &amount
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("Parâmetro limit inválido")
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
@@ -1,122 +1,117 @@
 package transaction
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 
+	"cajueiro/code/transactions/handlers/auth"
+	"cajueiro/code/transactions/handlers/idempotency"
 	"cajueiro/code/transactions/models"
 	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
-// ListTransactions lista as transaferencias da conta no banco de dados
+// ListTransactions lista as transações da conta do portador, com filtros,
+// ordenação e paginação por cursor
 func ListTransactions(app *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
-		// criando a chave JWT usada para verificar a assinatura
-		var jwtKey = []byte(app.Cfg.GetTokenKey())
-
-		// capturando o token JWT no cabeçalho do request
-		if r.Header["Token"] == nil {
-			// caso o token seja nulo retorna 401
-			http.Error(w, "Token nulo", http.StatusUnauthorized)
+		a, ok := auth.Authenticate(app, w, r)
+		if !ok {
 			return
 		}
 
-		// capturar a string do token JWT
-		tknStr := r.Header.Get("Token")
+		listTransactions(app, w, r, a.ID)
 
-		// inicializar um struct claims
-		claims := &models.Claims{}
+	}
+}
 
-		// Parse da string JWT e armazena o resultado no struct claims
-		tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				http.Error(w, "Assinatura inválida", http.StatusUnauthorized)
-				return
-			}
-			http.Error(w, "Token inválido", http.StatusUnauthorized)
-			w.WriteHeader(http.StatusBadRequest)
+// GetTransaction retorna o registro completo da transação, com as regras
+// antifraude disparadas e as transações ligadas; só as contas de origem e de
+// destino podem consultá-la
+func GetTransaction(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// capturando a conta do token JWT
+		a, ok := auth.Authenticate(app, w, r)
+		if !ok {
 			return
 		}
-		if !tkn.Valid {
-			http.Error(w, "Token Expirou", http.StatusUnauthorized)
-			w.WriteHeader(http.StatusUnauthorized)
+
+		// Pegando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrTransactionNotFound.Error(), http.StatusNotFound)
 			return
 		}
 
-		// capturando transactions no DB
-		a := &models.Account{}
-		if err := app.DB.Client.Preload("Transaction").First(&a, "cpf = ?", claims.CPF); err.Error != nil {
-			// caso tenha erro ao procurar no banco retorna 500
-			http.Error(w, "Erro na listagem das transferências", http.StatusInternalServerError)
+		transaction, err := models.FindTransaction(app.DB.Client.WithContext(r.Context()), id, a.ID)
+		if err == models.ErrTransactionNotFound {
+			// transação de outra conta também retorna 404
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(a.Transaction)
+		json.NewEncoder(w).Encode(transaction)
 
 	}
 }
 
-// PostTransactions handler para criar transactions no DB
-func PostTransactions(app *app.App) http.HandlerFunc {
+// ListAccountTransactions lista as transações de qualquer conta para os
+// operadores, com os mesmos filtros de ListTransactions
+func ListAccountTransactions(app *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
-		// criando a chave JWT usada para verificar a assinatura
-		var jwtKey = []byte(app.Cfg.GetTokenKey())
+		// Pegando id na url
+		id := mux.Vars(r)["id"]
 
-		// capturando o token JWT no cabeçalho do request
-		if r.Header["Token"] == nil {
-			// caso o token seja nulo retorna 401
-			http.Error(w, "Token nulo", http.StatusUnauthorized)
+		// Pegando account no banco de dados
+		a := &models.Account{}
+		if err := app.DB.Client.WithContext(r.Context()).First(&a, &id); err.Error != nil {
+			// caso tenha erro ao procurar no banco retorna 404
+			http.Error(w, "Conta não encontrada", http.StatusNotFound)
 			return
 		}
 
-		// capturar a string do token JWT
-		tknStr := r.Header.Get("Token")
+		listTransactions(app, w, r, a.ID)
 
-		// inicializar um struct claims
-		claims := &models.Claims{}
+	}
+}
 
-		// Parse da string JWT e armazena o resultado no struct claims
-		tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				http.Error(w, "Assinatura inválida", http.StatusUnauthorized)
-				return
-			}
-			http.Error(w, "Token inválido", http.StatusUnauthorized)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if !tkn.Valid {
-			http.Error(w, "Token Expirou", http.StatusUnauthorized)
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+// PostTransactions handler para criar transactions no DB
+func PostTransactions(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
 
-		// capturando account no DB
-		a := &models.Account{}
-		if err := app.DB.Client.First(&a, "cpf = ?", claims.CPF); err.Error != nil {
-			// caso tenha erro ao procurar no banco retorna 500
-			http.Error(w, "Erro na criação da transferência", http.StatusInternalServerError)
+		// capturando a conta do token JWT
+		a, ok := auth.Authenticate(app, w, r)
+		if !ok {
 			return
 		}
 
 		// capturando transactions no request
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Erro na leitura do request", http.StatusBadRequest)
+			return
+		}
 		t := &models.Transaction{}
-		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		if err := json.Unmarshal(body, &t); err != nil {
 			// caso tenha erro no decode do request retorna 400
 			http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
 			return
@@ -136,17 +131,186 @@ func PostTransactions(app *app.App) http.HandlerFunc {
 			return
 		}
 
-		// armazenando struct transaction no DB
-		transaction, err := t.CreateTransaction(app)
+		// request repetido com a mesma chave de idempotência (ou external_id)
+		// recebe a resposta original sem criar outra transação
+		idempotency.Run(app, w, r, a.ID, t.External_id, body, func(w http.ResponseWriter, r *http.Request) {
+
+			// a autorização tem o prazo de AUTH_TIMEOUT_MS; ao estourar é recusada com "91"
+			ctx, cancel := context.WithTimeout(r.Context(), app.Cfg.GetAuthTimeout())
+			defer cancel()
+
+			// armazenando struct transaction no DB
+			transaction, err := t.CreateTransaction(ctx, app)
+			if err != nil {
+				// caso tenha erro ao armazenar no banco retorna 500
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			// o status HTTP segue o código de resposta da autorização
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(models.HTTPStatus(transaction.Code))
+			json.NewEncoder(w).Encode(transaction.Authorization())
+		})
+
+	}
+}
+
+// CaptureTransaction handler para capturar uma pré-autorização, total ou
+// parcialmente
+func CaptureTransaction(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// conta do estabelecimento pelo token JWT ou operador pelo token administrativo
+		accountID, ok := auth.AccountOrAdmin(app, w, r)
+		if !ok {
+			return
+		}
+
+		// Pegando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
 		if err != nil {
-			// caso tenha erro ao armazenar no banco retorna 500
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, models.ErrHoldNotFound.Error(), http.StatusNotFound)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(transaction)
+		// valor da captura, opcional; sem valor captura o total
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Erro na leitura do request", http.StatusBadRequest)
+			return
+		}
+		capture := struct {
+			Amount money.Money `json:"amount"`
+		}{}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &capture); err != nil {
+				// caso tenha erro no decode do request retorna 400
+				http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+				return
+			}
+		}
+
+		idempotency.Run(app, w, r, accountID, "", body, func(w http.ResponseWriter, r *http.Request) {
+			transaction, err := models.CaptureTransaction(r.Context(), app, id, accountID, capture.Amount)
+			if err != nil {
+				holdError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(transaction.Authorization())
+		})
+
+	}
+}
+
+// VoidTransaction handler para cancelar uma pré-autorização
+func VoidTransaction(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// conta do estabelecimento pelo token JWT ou operador pelo token administrativo
+		accountID, ok := auth.AccountOrAdmin(app, w, r)
+		if !ok {
+			return
+		}
+
+		// Pegando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrHoldNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		idempotency.Run(app, w, r, accountID, "", nil, func(w http.ResponseWriter, r *http.Request) {
+			transaction, err := models.VoidTransaction(r.Context(), app, id, accountID)
+			if err != nil {
+				holdError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(transaction.Authorization())
+		})
+
+	}
+}
+
+// ReverseTransaction handler para estornar uma compra ou captura, total ou
+// parcialmente
+func ReverseTransaction(app *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// conta do estabelecimento pelo token JWT ou operador pelo token administrativo
+		accountID, ok := auth.AccountOrAdmin(app, w, r)
+		if !ok {
+			return
+		}
+
+		// Pegando id na url
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, models.ErrReversalNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		// valor do estorno, opcional; sem valor estorna o saldo restante
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Erro na leitura do request", http.StatusBadRequest)
+			return
+		}
+		reversal := struct {
+			Amount      money.Money `json:"amount"`
+			External_id string      `json:"external_id"`
+		}{}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &reversal); err != nil {
+				// caso tenha erro no decode do request retorna 400
+				http.Error(w, "Formato JSON inválido", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// estorno repetido com a mesma chave não devolve o valor duas vezes
+		idempotency.Run(app, w, r, accountID, reversal.External_id, body, func(w http.ResponseWriter, r *http.Request) {
+			transaction, err := models.ReverseTransaction(r.Context(), app, id, accountID, reversal.Amount)
+			switch err {
+			case nil:
+			case models.ErrReversalNotFound:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case models.ErrReversalAmount, models.ErrReversalBalance:
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(transaction.Authorization())
+		})
+
+	}
+}
 
+// holdError responde o erro da captura ou do cancelamento
+func holdError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrHoldNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case models.ErrHoldNotActive:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case models.ErrCaptureAmount:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
+	"cajueiro/code/transactions/handlers/iso"
 	"cajueiro/code/transactions/models"
 	"cajueiro/code/transactions/routers"
 	"cajueiro/pkg/app"
 	"cajueiro/pkg/exit"
+	"cajueiro/pkg/job"
 	"cajueiro/pkg/logger"
 	"cajueiro/pkg/server"
 
@@ -37,10 +42,20 @@ func initapp() error {
 
 func initdb() error {
 	// migrando os schemas do DB
-	err := api.DB.Client.AutoMigrate(&models.Account{}, &models.Transaction{})
+	err := models.Migrate(api.DB.Client)
 	if err != nil {
 		logrus.Fatal("Erro na migração dos dados")
 	}
+	// carregando o mapeamento de mcc para categoria
+	err = models.LoadMccCategories(api)
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	// criando as regras antifraude padrão
+	err = models.LoadFraudRules(api)
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
 	return err
 }
 
@@ -75,13 +90,97 @@ func main() {
 		}
 	}()
 
+	// servidor ISO 8583 das redes de cartão, habilitado por ISO_SERVER_ADDRESS
+	isoSrv := server.
+		GetISOServer().
+		WithAddr(api.Cfg.GetISOPort()).
+		WithHandler(iso.Authorize(api)).
+		WithLogger(logger.Error)
+
+	if api.Cfg.GetISOPort() != "" {
+		go func() {
+			api.Log.Info("Iniciando servidor ISO 8583 na porta ", api.Cfg.GetISOPort())
+			if err := isoSrv.StartServer(); err != nil {
+				api.Log.Fatal(err.Error())
+			}
+		}()
+	}
+
+	// job que libera o saldo das pré-autorizações vencidas
+	holdsJob := job.
+		GetJob("holds").
+		WithInterval(time.Minute).
+		WithTask(releaseExpiredHolds).
+		WithLogger(logger.Error)
+
+	if err := holdsJob.StartJob(); err != nil {
+		api.Log.Fatal(err.Error())
+	}
+
+	// job que lança os créditos agendados dos empregadores
+	topUpsJob := job.
+		GetJob("top-ups").
+		WithInterval(api.Cfg.GetTopUpInterval()).
+		WithTask(runTopUps).
+		WithLogger(logger.Error)
+
+	if err := topUpsJob.StartJob(); err != nil {
+		api.Log.Fatal(err.Error())
+	}
+
+	// job que expira o saldo dos créditos vencidos
+	creditsJob := job.
+		GetJob("credits").
+		WithInterval(time.Minute).
+		WithTask(expireCredits).
+		WithLogger(logger.Error)
+
+	if err := creditsJob.StartJob(); err != nil {
+		api.Log.Fatal(err.Error())
+	}
+
 	exit.Init(func() {
+		holdsJob.CloseJob()
+		topUpsJob.CloseJob()
+		creditsJob.CloseJob()
+
 		if err := srv.CloseServer(); err != nil {
 			api.Log.Error(err.Error())
 		}
 
+		if err := isoSrv.CloseServer(); err != nil {
+			api.Log.Error(err.Error())
+		}
+
 		if err := api.DB.CloseDB(); err != nil {
 			api.Log.Error(err.Error())
 		}
 	})
 }
+
+// releaseExpiredHolds tarefa do job de expiração das pré-autorizações
+func releaseExpiredHolds() error {
+	released, err := models.ReleaseExpiredHolds(api)
+	if released > 0 {
+		api.Log.Info(fmt.Sprintf("%d pré-autorizações vencidas liberadas", released))
+	}
+	return err
+}
+
+// runTopUps tarefa do job de créditos agendados dos empregadores
+func runTopUps() error {
+	credited, err := models.RunTopUps(api, time.Now())
+	if credited > 0 {
+		api.Log.Info(fmt.Sprintf("%d créditos agendados lançados", credited))
+	}
+	return err
+}
+
+// expireCredits tarefa do job de expiração dos créditos com validade
+func expireCredits() error {
+	expired, err := models.ExpireCredits(api)
+	if expired > 0 {
+		api.Log.Info(fmt.Sprintf("%d créditos vencidos expirados", expired))
+	}
+	return err
+}
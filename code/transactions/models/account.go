@@ -5,9 +5,18 @@ import (
 	"time"
 
 	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
 	"cajueiro/pkg/secret"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categorias de carteira padrão da conta
+const (
+	WalletFood = "food"
+	WalletMeal = "meal"
+	WalletCash = "cash"
 )
 
 // BeforeCreate hook do gorm para gerar uuid no create
@@ -21,39 +30,155 @@ func (a *Account) BeforeCreate(tx *gorm.DB) (err error) {
 
 // Account modelo para conta do usuário
 type Account struct {
-	gorm.Model  `json:"-"`
-	ID          int            `json:"id" gorm:"not null"`
-	CPF         string         `gorm:"unique" json:"cpf" validate:"required,len=11"`
-	Secret      string         `json:"secret" validate:"required"`
-	Amount_food float64        `json:"amount_food" validate:"required"`
-	Amount_meal float64        `json:"amount_meal" validate:"required"`
-	Amount_cash float64        `json:"amount_cash" validate:"required"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted"`
-	Transaction []Transaction  `json:"-" gorm:"foreignKey:Account_id"`
+	gorm.Model    `json:"-"`
+	ID            int            `json:"id" gorm:"not null"`
+	CPF           string         `gorm:"unique" json:"cpf" validate:"required,len=11"`
+	Secret        string         `json:"secret" validate:"required"`
+	Wallets       []Wallet       `json:"wallets" gorm:"foreignKey:Account_id" validate:"dive"` // SALDOS POR CATEGORIA
+	Cash_fallback bool           `json:"cash_fallback"`                                        // PERMITE DEBITAR CASH QUANDO A CARTEIRA DA CATEGORIA FOR INSUFICIENTE
+	Employer_id   *int           `json:"employer_id,omitempty" gorm:"index"`                   // EMPREGADOR QUE CREDITA OS BENEFÍCIOS
+	Status        string         `json:"status" gorm:"not null;default:active;index"`          // active, blocked OU closed
+	Status_reason string         `json:"status_reason,omitempty"`                              // MOTIVO DA ÚLTIMA MUDANÇA DE SITUAÇÃO
+	Closed_at     *time.Time     `json:"closed_at,omitempty"`                                  // ENCERRAMENTO DA CONTA
+	Version       int            `json:"version" gorm:"not null;default:1"`                    // VERSÃO PARA CONCORRÊNCIA OTIMISTA (ETag)
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted"`
+	Transaction   []Transaction  `json:"-" gorm:"foreignKey:Account_id"`
 }
 
-// CreateAccount cria uma conta de usuário
+// CreateAccount cria uma conta de usuário com uma carteira para cada categoria configurada
+//
+// Os saldos iniciais entram como créditos no livro-razão, com a contrapartida
+// na conta externa.
 func (a *Account) CreateAccount(app *app.App) (*Account, error) {
 
+	wallets, err := newWallets(app, a.Wallets)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Employer_id != nil {
+		if _, err := FindEmployer(app, *a.Employer_id); err != nil {
+			return nil, err
+		}
+	}
+
+	// as carteiras nascem zeradas e recebem o saldo inicial pelos lançamentos
+	initial := map[string]money.Money{}
+	for i := range wallets {
+		initial[wallets[i].Category] = wallets[i].Balance
+		wallets[i].Balance = 0
+	}
+
 	account := &Account{
-		ID:          a.ID,
-		CPF:         a.CPF,
-		Secret:      a.Secret,
-		Amount_food: a.Amount_food,
-		Amount_meal: a.Amount_meal,
-		Amount_cash: a.Amount_cash,
-		CreatedAt:   a.CreatedAt,
-		Transaction: a.Transaction,
+		ID:            a.ID,
+		CPF:           a.CPF,
+		Secret:        a.Secret,
+		Wallets:       wallets,
+		Cash_fallback: a.Cash_fallback,
+		Employer_id:   a.Employer_id,
+		Status:        AccountActive,
+		Version:       1,
+		CreatedAt:     a.CreatedAt,
+		Transaction:   a.Transaction,
 	}
 
-	result := app.DB.Client.Create(account)
+	err = app.DB.Client.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(account); result.Error != nil {
+			return result.Error
+		}
 
-	if result.Error != nil {
+		var opening []posting
+		for _, w := range account.Wallets {
+			opening = append(opening,
+				posting{account: account, wallet: w.Category, amount: initial[w.Category]},
+				posting{wallet: w.Category, amount: -initial[w.Category]},
+			)
+		}
+		return postEntries(tx, nil, "Saldo inicial", opening...)
+	})
+	if err != nil {
 		return nil, errors.New("Erro ao criar a conta")
 	}
 
 	return account, nil
+}
+
+// walletBalance retorna o saldo contábil da carteira informada
+func (a *Account) walletBalance(category string) money.Money {
+	for _, w := range a.Wallets {
+		if w.Category == category {
+			return w.Balance
+		}
+	}
+	return 0
+}
+
+// available retorna o saldo disponível da carteira informada
+func (a *Account) available(category string) money.Money {
+	for _, w := range a.Wallets {
+		if w.Category == category {
+			return w.Available()
+		}
+	}
+	return 0
+}
+
+// updateBalance soma o valor (negativo para débito) no saldo em cache da
+// carteira informada, criando a carteira caso a conta ainda não tenha a
+// categoria; use postEntries, que grava o lançamento correspondente
+//
+// A conta deve estar travada pela transação do banco recebida em tx.
+func (a *Account) updateBalance(tx *gorm.DB, category string, amount money.Money) error {
+
+	wallet := &Wallet{Account_id: a.ID, Category: category, Balance: amount}
+	result := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "account_id"}, {Name: "category"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"balance":    gorm.Expr("wallets.balance + excluded.balance"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(wallet)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for i := range a.Wallets {
+		if a.Wallets[i].Category == category {
+			a.Wallets[i].Balance = a.Wallets[i].Balance + amount
+			return nil
+		}
+	}
+	a.Wallets = append(a.Wallets, *wallet)
+
+	return nil
+}
+
+// updateHeld soma o valor (negativo para liberação) ao saldo bloqueado da
+// carteira informada
+//
+// A conta deve estar travada pela transação do banco recebida em tx.
+func (a *Account) updateHeld(tx *gorm.DB, category string, amount money.Money) error {
+
+	result := tx.Model(&Wallet{}).
+		Where("account_id = ? AND category = ?", a.ID, category).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr("held + ?", amount),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("Carteira não encontrada: " + category)
+	}
+
+	for i := range a.Wallets {
+		if a.Wallets[i].Category == category {
+			a.Wallets[i].Held = a.Wallets[i].Held + amount
+		}
+	}
 
+	return nil
 }
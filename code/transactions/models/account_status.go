@@ -0,0 +1,190 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// situações de uma conta
+const (
+	AccountActive  = "active"  // LIBERADA PARA AUTORIZAÇÕES
+	AccountBlocked = "blocked" // BLOQUEADA PELO OPERADOR, RECUSA AS COMPRAS
+	AccountClosed  = "closed"  // ENCERRADA, PODE SER REABERTA
+)
+
+// erros da manutenção da conta
+var (
+	ErrAccountStatus  = errors.New("Operação não permitida na situação atual da conta")
+	ErrAccountVersion = errors.New("A conta foi alterada desde a última leitura")
+	ErrAccountBalance = errors.New("A conta só pode ser encerrada com todas as carteiras zeradas")
+	ErrAccountCPF     = errors.New("CPF já cadastrado em outra conta")
+)
+
+// AccountPatch campos da conta alterados por PATCH /accounts/{id}; campos
+// ausentes não são alterados
+type AccountPatch struct {
+	CPF           *string `json:"cpf" validate:"omitempty,len=11,numeric"`
+	Cash_fallback *bool   `json:"cash_fallback"`
+	Employer_id   *int    `json:"employer_id"`
+}
+
+// FindAccount procura a conta com as suas carteiras
+func FindAccount(app *app.App, id int) (*Account, error) {
+
+	var accounts []Account
+	if result := app.DB.Client.Preload("Wallets").Where("id = ?", id).Limit(1).Find(&accounts); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a conta")
+	}
+	if len(accounts) == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	return &accounts[0], nil
+}
+
+// UpdateAccount altera os campos informados da conta; com version diferente
+// de zero a alteração só acontece se a conta ainda estiver nessa versão
+func (p *AccountPatch) UpdateAccount(app *app.App, id, version int) (*Account, error) {
+
+	if p.Employer_id != nil {
+		if _, err := FindEmployer(app, *p.Employer_id); err != nil {
+			return nil, err
+		}
+	}
+
+	return changeAccount(app, id, version, func(tx *gorm.DB, a *Account) (map[string]interface{}, error) {
+		if a.Status == AccountClosed {
+			return nil, ErrAccountStatus
+		}
+
+		updates := map[string]interface{}{}
+		if p.CPF != nil && *p.CPF != a.CPF {
+			var count int64
+			if result := tx.Model(&Account{}).Where("cpf = ? AND id <> ?", *p.CPF, a.ID).Count(&count); result.Error != nil {
+				return nil, errors.New("Erro ao atualizar a conta")
+			} else if count > 0 {
+				return nil, ErrAccountCPF
+			}
+			updates["cpf"] = *p.CPF
+		}
+		if p.Cash_fallback != nil {
+			updates["cash_fallback"] = *p.Cash_fallback
+		}
+		if p.Employer_id != nil {
+			updates["employer_id"] = *p.Employer_id
+		}
+
+		return updates, nil
+	})
+}
+
+// BlockAccount bloqueia uma conta ativa; as compras passam a ser recusadas
+func BlockAccount(app *app.App, id int, reason string) (*Account, error) {
+	return changeAccountStatus(app, id, reason, AccountBlocked, AccountActive)
+}
+
+// UnblockAccount libera uma conta bloqueada
+func UnblockAccount(app *app.App, id int, reason string) (*Account, error) {
+	return changeAccountStatus(app, id, reason, AccountActive, AccountBlocked)
+}
+
+// RestoreAccount reabre uma conta encerrada
+func RestoreAccount(app *app.App, id int, reason string) (*Account, error) {
+	return changeAccountStatus(app, id, reason, AccountActive, AccountClosed)
+}
+
+// CloseAccount encerra a conta ativa ou bloqueada, desde que todas as
+// carteiras estejam zeradas
+//
+// A conta fica travada enquanto os saldos são conferidos, de forma que uma
+// autorização simultânea espera o encerramento e é recusada em seguida.
+func CloseAccount(app *app.App, id int, reason string) (*Account, error) {
+
+	return changeAccount(app, id, 0, func(tx *gorm.DB, a *Account) (map[string]interface{}, error) {
+		if a.Status == AccountClosed {
+			return nil, ErrAccountStatus
+		}
+		for _, w := range a.Wallets {
+			if w.Balance != 0 || w.Held != 0 {
+				return nil, ErrAccountBalance
+			}
+		}
+
+		return map[string]interface{}{
+			"status":        AccountClosed,
+			"status_reason": reason,
+			"closed_at":     time.Now(),
+		}, nil
+	})
+}
+
+// changeAccountStatus muda a situação da conta para status se ela estiver
+// na situação from
+func changeAccountStatus(app *app.App, id int, reason, status, from string) (*Account, error) {
+
+	return changeAccount(app, id, 0, func(tx *gorm.DB, a *Account) (map[string]interface{}, error) {
+		if a.Status != from {
+			return nil, ErrAccountStatus
+		}
+
+		return map[string]interface{}{
+			"status":        status,
+			"status_reason": reason,
+			"closed_at":     nil,
+		}, nil
+	})
+}
+
+// changeAccount trava a conta, aplica as alterações retornadas por change e
+// incrementa a versão; com version diferente de zero a conta precisa estar
+// nessa versão
+func changeAccount(app *app.App, id, version int, change func(tx *gorm.DB, a *Account) (map[string]interface{}, error)) (*Account, error) {
+
+	a := &Account{}
+	err := app.DB.Client.Transaction(func(tx *gorm.DB) error {
+
+		var accounts []Account
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Wallets").
+			Where("id = ?", id).
+			Limit(1).
+			Find(&accounts); result.Error != nil {
+			return errors.New("Erro ao consultar a conta")
+		}
+		if len(accounts) == 0 {
+			return ErrAccountNotFound
+		}
+		*a = accounts[0]
+
+		if version != 0 && a.Version != version {
+			return ErrAccountVersion
+		}
+
+		updates, err := change(tx, a)
+		if err != nil {
+			return err
+		}
+		updates["version"] = a.Version + 1
+
+		if result := tx.Model(&Account{}).Where("id = ?", a.ID).Updates(updates); result.Error != nil {
+			return errors.New("Erro ao atualizar a conta")
+		}
+
+		*a = Account{}
+		if result := tx.Preload("Wallets").First(a, id); result.Error != nil {
+			return errors.New("Erro ao consultar a conta")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
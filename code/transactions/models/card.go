@@ -0,0 +1,265 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/luhn"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// situações de um cartão
+const (
+	CardActive   = "active"   // LIBERADO PARA AUTORIZAÇÕES
+	CardBlocked  = "blocked"  // BLOQUEADO TEMPORARIAMENTE PELO PORTADOR
+	CardCanceled = "canceled" // CANCELADO EM DEFINITIVO
+)
+
+// emissão dos cartões
+const (
+	cardBIN           = "650487" // PREFIXO DOS CARTÕES EMITIDOS
+	cardLength        = 16
+	cardValidityYears = 5
+	cardIssueAttempts = 5 // TENTATIVAS QUANDO O PAN GERADO JÁ EXISTE
+)
+
+// erros do ciclo de vida do cartão
+var (
+	ErrCardNotFound = errors.New("Cartão não encontrado")
+	ErrCardStatus   = errors.New("Operação não permitida na situação atual do cartão")
+)
+
+// Card cartão físico ou virtual vinculado a uma conta
+//
+// O PAN completo só é retornado na emissão; o banco guarda o PAN mascarado e
+// o hash usado para encontrar o cartão nas mensagens ISO 8583. Nas
+// autorizações por POST /transactions o cartão é identificado pelo token.
+type Card struct {
+	ID         int       `json:"-" gorm:"primaryKey"`
+	Token      uuid.UUID `json:"token" gorm:"type:uuid;not null;uniqueIndex"`
+	Account_id int       `json:"account_id" gorm:"not null;index"`
+	Pan_hash   string    `json:"-" gorm:"not null;uniqueIndex"` // HMAC-SHA256 DO PAN COM A CHAVE PAN_HASH_KEY
+	Masked_pan string    `json:"masked_pan" gorm:"not null"`    // SEIS PRIMEIROS E QUATRO ÚLTIMOS DÍGITOS
+	Pan        string    `json:"pan,omitempty" gorm:"-"`        // PAN COMPLETO, APENAS NA EMISSÃO
+	Expiry     string    `json:"expiry" gorm:"not null"`        // MM/AA
+	Expires_at time.Time `json:"-" gorm:"not null"`             // INÍCIO DO MÊS SEGUINTE À VALIDADE
+	Status     string    `json:"status" gorm:"not null;index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IssueCard emite um cartão para a conta ativa, com PAN válido pelo algoritmo
+// de Luhn e validade de 5 anos, até o fim do mês no fuso horário configurado;
+// conta bloqueada ou encerrada retorna ErrAccountStatus
+func IssueCard(app *app.App, accountID int) (*Card, error) {
+
+	a, err := FindAccount(app, accountID)
+	if err != nil {
+		return nil, err
+	}
+	// conta bloqueada ou encerrada não recebe cartão
+	if a.Status != AccountActive {
+		return nil, ErrAccountStatus
+	}
+
+	now := time.Now().In(app.Cfg.GetLocation())
+	expires := time.Date(now.Year()+cardValidityYears, now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+
+	for i := 0; i < cardIssueAttempts; i++ {
+		pan, err := generatePAN()
+		if err != nil {
+			return nil, errors.New("Erro ao gerar o número do cartão")
+		}
+
+		card := &Card{
+			Token:      uuid.New(),
+			Account_id: accountID,
+			Pan_hash:   hashPAN(app.Cfg.GetPANKey(), pan),
+			Masked_pan: maskPAN(pan),
+			Expiry:     expires.AddDate(0, -1, 0).Format("01/06"),
+			Expires_at: expires,
+			Status:     CardActive,
+		}
+		result := app.DB.Client.Clauses(clause.OnConflict{DoNothing: true}).Create(card)
+		if result.Error != nil {
+			return nil, errors.New("Erro ao emitir o cartão")
+		}
+		if result.RowsAffected == 1 {
+			card.Pan = pan
+			return card, nil
+		}
+	}
+
+	return nil, errors.New("Erro ao emitir o cartão")
+}
+
+// FindCards retorna os cartões da conta, do mais recente para o mais antigo
+func FindCards(app *app.App, accountID int) ([]Card, error) {
+
+	cards := []Card{}
+	if result := app.DB.Client.Where("account_id = ?", accountID).Order("id DESC").Find(&cards); result.Error != nil {
+		return nil, errors.New("Erro ao consultar os cartões da conta")
+	}
+
+	return cards, nil
+}
+
+// FindCardByPAN procura o cartão pelo PAN recebido na mensagem ISO 8583;
+// retorna nil se nenhum cartão foi emitido com esse PAN
+func FindCardByPAN(ctx context.Context, app *app.App, pan string) (*Card, error) {
+
+	var cards []Card
+	if result := app.DB.Client.WithContext(ctx).Where("pan_hash = ?", hashPAN(app.Cfg.GetPANKey(), pan)).Limit(1).Find(&cards); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o cartão do portador")
+	}
+	if len(cards) == 0 {
+		return nil, nil
+	}
+
+	return &cards[0], nil
+}
+
+// BlockCard bloqueia um cartão ativo da conta
+func BlockCard(app *app.App, accountID int, token uuid.UUID) (*Card, error) {
+	return changeCardStatus(app, accountID, token, CardBlocked, CardActive)
+}
+
+// UnblockCard libera um cartão bloqueado da conta
+func UnblockCard(app *app.App, accountID int, token uuid.UUID) (*Card, error) {
+	return changeCardStatus(app, accountID, token, CardActive, CardBlocked)
+}
+
+// CancelCard cancela em definitivo um cartão ativo ou bloqueado da conta
+func CancelCard(app *app.App, accountID int, token uuid.UUID) (*Card, error) {
+	return changeCardStatus(app, accountID, token, CardCanceled, CardActive, CardBlocked)
+}
+
+// changeCardStatus muda a situação do cartão para status se ele estiver em
+// uma das situações from
+func changeCardStatus(app *app.App, accountID int, token uuid.UUID, status string, from ...string) (*Card, error) {
+
+	card := &Card{}
+	err := app.DB.Client.Transaction(func(tx *gorm.DB) error {
+
+		var cards []Card
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND account_id = ?", token, accountID).
+			Limit(1).
+			Find(&cards); result.Error != nil {
+			return errors.New("Erro ao consultar o cartão")
+		}
+		if len(cards) == 0 {
+			return ErrCardNotFound
+		}
+		*card = cards[0]
+
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || card.Status == s
+		}
+		if !allowed {
+			return ErrCardStatus
+		}
+
+		card.Status = status
+		if result := tx.Save(card); result.Error != nil {
+			return errors.New("Erro ao atualizar o cartão")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+// lockCard trava em modo compartilhado o cartão da transação, para que um
+// bloqueio ou cancelamento simultâneo espere a autorização terminar;
+// retorna nil se o token não existir
+func (t *Transaction) lockCard(tx *gorm.DB) (*Card, error) {
+
+	token, err := uuid.Parse(t.Card_token)
+	if err != nil {
+		return nil, nil
+	}
+
+	var cards []Card
+	if result := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+		Where("token = ?", token).
+		Limit(1).
+		Find(&cards); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o cartão da transação")
+	}
+	if len(cards) == 0 {
+		return nil, nil
+	}
+
+	return &cards[0], nil
+}
+
+// checkCard recusa a transação se o cartão não for da conta de origem ou não
+// estiver ativo e dentro da validade; retorna false se a transação foi recusada
+func (t *Transaction) checkCard(card *Card, now time.Time) bool {
+
+	switch {
+	case card == nil || card.Account_id != t.Account_id:
+		t.decline(CodeInvalidAccount, ReasonInvalidCard, "Transação não autorizada - Cartão inválido")
+	case card.Status == CardCanceled:
+		t.decline(CodeInvalidAccount, ReasonCardCanceled, "Transação não autorizada - Cartão cancelado")
+	case card.Status == CardBlocked:
+		t.decline(CodeCardBlocked, ReasonCardBlocked, "Transação não autorizada - Cartão bloqueado")
+	case !now.Before(card.Expires_at):
+		t.decline(CodeCardExpired, ReasonCardExpired, "Transação não autorizada - Cartão vencido")
+	default:
+		t.Card_id = &card.ID
+		return true
+	}
+
+	return false
+}
+
+// generatePAN gera um PAN aleatório com o prefixo do emissor e o dígito
+// verificador de Luhn
+func generatePAN() (string, error) {
+
+	var b strings.Builder
+	b.WriteString(cardBIN)
+	for b.Len() < cardLength-1 {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + n.Int64()))
+	}
+	b.WriteByte(luhn.CheckDigit(b.String()))
+
+	return b.String(), nil
+}
+
+// maskPAN mantém os seis primeiros e os quatro últimos dígitos do PAN
+func maskPAN(pan string) string {
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// hashPAN retorna o HMAC-SHA256 do PAN com a chave secreta, em hexadecimal
+//
+// Os PANs de um BIN cabem em poucos bilhões de combinações; sem a chave o
+// hash seria revertido por força bruta.
+func hashPAN(key, pan string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(pan))
+	return hex.EncodeToString(mac.Sum(nil))
+}
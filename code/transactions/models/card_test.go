@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"cajueiro/pkg/luhn"
+)
+
+func TestGeneratePAN(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		pan, err := generatePAN()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pan) != cardLength || !strings.HasPrefix(pan, cardBIN) || !luhn.Valid(pan) {
+			t.Fatalf("Expected a Luhn-valid PAN with prefix %s. Got %s", cardBIN, pan)
+		}
+	}
+}
+
+func TestMaskPAN(t *testing.T) {
+
+	if got := maskPAN("6504871234567890"); got != "650487******7890" {
+		t.Errorf("Expected 650487******7890. Got %s", got)
+	}
+}
+
+func TestHashPANDependsOnKey(t *testing.T) {
+
+	pan := "6504871234567890"
+	if hashPAN("chave", pan) != hashPAN("chave", pan) {
+		t.Errorf("Expected the same hash for the same key and PAN")
+	}
+	if hashPAN("chave", pan) == hashPAN("outra", pan) {
+		t.Errorf("Expected different hashes for different keys")
+	}
+	if hashPAN("chave", pan) == hashPAN("chave", "6504871234567891") {
+		t.Errorf("Expected different hashes for different PANs")
+	}
+}
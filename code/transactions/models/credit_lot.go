@@ -0,0 +1,317 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// situações de um crédito com validade
+const (
+	LotActive   = "active"
+	LotConsumed = "consumed"
+	LotExpired  = "expired"
+)
+
+// quantidade de créditos vencidos processados por consulta no job de expiração
+const expiredLotsBatch = 100
+
+// CreditLot crédito com validade lançado em uma carteira
+//
+// Os débitos da carteira consomem primeiro os créditos que vencem antes
+// (FIFO pela validade) e só depois o saldo sem validade. O que sobra de um
+// crédito vencido é debitado pelo job de expiração contra a conta externa.
+type CreditLot struct {
+	ID         uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey"`   // IDENTIFICADOR DO LANÇAMENTO DE EXPIRAÇÃO
+	Source_id  uuid.UUID   `json:"source_id" gorm:"type:uuid;index"` // LANÇAMENTO QUE CREDITOU O VALOR
+	Account_id int         `json:"account_id" gorm:"not null;index:idx_credit_lots_account_wallet"`
+	Wallet     string      `json:"wallet" gorm:"not null;index:idx_credit_lots_account_wallet"`
+	Amount     money.Money `json:"amount" gorm:"not null"`
+	Remaining  money.Money `json:"remaining" gorm:"not null"`         // AINDA NÃO CONSUMIDO
+	Expired    money.Money `json:"expired" gorm:"not null;default:0"` // DEBITADO NA EXPIRAÇÃO
+	Status     string      `json:"status" gorm:"not null;index:idx_credit_lots_status_expires"`
+	Expires_at time.Time   `json:"expires_at" gorm:"not null;index:idx_credit_lots_status_expires"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// CreditLotUse parte de um crédito com validade consumida por um débito
+//
+// O estorno devolve o valor aos mesmos créditos com um uso negativo na
+// transação original, de forma que a soma dos usos de uma transação por
+// crédito é o que ainda pode ser devolvido a ele.
+type CreditLotUse struct {
+	ID             int         `json:"-" gorm:"primaryKey"`
+	Lot_id         uuid.UUID   `json:"lot_id" gorm:"type:uuid;not null;index"`
+	Transaction_id uuid.UUID   `json:"transaction_id" gorm:"type:uuid;not null;index"` // DÉBITO QUE CONSUMIU O CRÉDITO
+	Amount         money.Money `json:"amount" gorm:"not null"`                         // NEGATIVO QUANDO DEVOLVIDO POR ESTORNO
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// ExpiringAmount valor da carteira que vence em uma data
+type ExpiringAmount struct {
+	Date   string      `json:"date"` // AAAA-MM-DD NO FUSO HORÁRIO CONFIGURADO
+	Amount money.Money `json:"amount"`
+}
+
+// expiresAfter retorna o instante em que vence um crédito válido até o fim
+// do dia informado no fuso horário loc
+func expiresAfter(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// addLot registra o crédito com validade lançado na carteira da conta
+func (a *Account) addLot(tx *gorm.DB, wallet string, amount money.Money, source uuid.UUID, expires time.Time) error {
+
+	lot := &CreditLot{
+		ID:         uuid.New(),
+		Source_id:  source,
+		Account_id: a.ID,
+		Wallet:     wallet,
+		Amount:     amount,
+		Remaining:  amount,
+		Status:     LotActive,
+		Expires_at: expires,
+	}
+	if result := tx.Create(lot); result.Error != nil {
+		return errors.New("Erro ao registrar a validade do crédito")
+	}
+
+	return nil
+}
+
+// consumeLots abate o débito da transação informada dos créditos com validade
+// da carteira, dos que vencem antes para os que vencem depois; o que passar
+// do total dos créditos com validade sai do saldo sem validade
+//
+// A conta deve estar travada pela transação do banco recebida em tx.
+func (a *Account) consumeLots(tx *gorm.DB, wallet string, amount money.Money, transactionID uuid.UUID) error {
+
+	var lots []CreditLot
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("account_id = ? AND wallet = ? AND status = ?", a.ID, wallet, LotActive).
+		Order("expires_at, created_at").
+		Find(&lots); result.Error != nil {
+		return errors.New("Erro ao consultar os créditos com validade")
+	}
+
+	for i := range lots {
+		if amount <= 0 {
+			break
+		}
+
+		lot := &lots[i]
+		consumed := lot.Remaining
+		if amount < consumed {
+			consumed = amount
+		}
+		lot.Remaining -= consumed
+		amount -= consumed
+		if lot.Remaining == 0 {
+			lot.Status = LotConsumed
+		}
+
+		if result := tx.Save(lot); result.Error != nil {
+			return errors.New("Erro ao consumir os créditos com validade")
+		}
+		if result := tx.Create(&CreditLotUse{Lot_id: lot.ID, Transaction_id: transactionID, Amount: consumed}); result.Error != nil {
+			return errors.New("Erro ao consumir os créditos com validade")
+		}
+	}
+
+	return nil
+}
+
+// restoreLots devolve o valor estornado aos créditos com validade consumidos
+// pela transação parentID, dos que vencem depois para os que vencem antes
+//
+// Créditos já vencidos não são reabertos: a parte deles e o que passar dos
+// créditos consumidos voltam como saldo sem validade. A conta deve estar
+// travada pela transação do banco recebida em tx.
+func (a *Account) restoreLots(tx *gorm.DB, wallet string, amount money.Money, parentID uuid.UUID) error {
+
+	var uses []struct {
+		Lot_id uuid.UUID
+		Amount money.Money
+	}
+	if result := tx.Table("credit_lot_uses u").
+		Select("u.lot_id, SUM(u.amount) AS amount").
+		Joins("JOIN credit_lots l ON l.id = u.lot_id").
+		Where("u.transaction_id = ? AND l.account_id = ? AND l.wallet = ?", parentID, a.ID, wallet).
+		Where("l.status <> ? AND l.expires_at > ?", LotExpired, time.Now()).
+		Group("u.lot_id, l.expires_at, l.created_at").
+		Having("SUM(u.amount) > 0").
+		Order("l.expires_at DESC, l.created_at DESC").
+		Scan(&uses); result.Error != nil {
+		return errors.New("Erro ao consultar os créditos com validade consumidos")
+	}
+
+	for _, u := range uses {
+		if amount <= 0 {
+			break
+		}
+
+		restored := u.Amount
+		if amount < restored {
+			restored = amount
+		}
+		amount -= restored
+
+		if result := tx.Model(&CreditLot{}).
+			Where("id = ?", u.Lot_id).
+			Updates(map[string]interface{}{
+				"remaining":  gorm.Expr("remaining + ?", restored),
+				"status":     LotActive,
+				"updated_at": time.Now(),
+			}); result.Error != nil {
+			return errors.New("Erro ao devolver os créditos com validade")
+		}
+		if result := tx.Create(&CreditLotUse{Lot_id: u.Lot_id, Transaction_id: parentID, Amount: -restored}); result.Error != nil {
+			return errors.New("Erro ao devolver os créditos com validade")
+		}
+	}
+
+	return nil
+}
+
+// ExpireCredits debita o que sobrou dos créditos vencidos e retorna quantos
+// créditos foram expirados
+//
+// Cada crédito é expirado em uma transação própria, com a conta e o crédito
+// travados. O valor bloqueado por pré-autorizações não expira: o débito é
+// limitado ao saldo disponível da carteira. Um crédito com erro é registrado
+// no log e não impede os demais; ele volta na próxima execução.
+func ExpireCredits(app *app.App) (int, error) {
+
+	expired, failed := 0, 0
+	now := time.Now()
+
+	// continua depois do último crédito do lote anterior, de forma que um
+	// crédito com erro não volta no lote seguinte
+	var last *CreditLot
+	for {
+		query := app.DB.Client.Where("status = ? AND expires_at <= ?", LotActive, now)
+		if last != nil {
+			query = query.Where("(expires_at, id) > (?, ?)", last.Expires_at, last.ID)
+		}
+
+		var lots []CreditLot
+		if result := query.
+			Order("expires_at").
+			Order("id").
+			Limit(expiredLotsBatch).
+			Find(&lots); result.Error != nil {
+			return expired, errors.New("Erro ao consultar os créditos vencidos")
+		}
+
+		for _, l := range lots {
+			ok, err := expireLot(app.DB.Client, l)
+			if err != nil {
+				failed++
+				app.Log.Error(fmt.Sprintf("Erro ao expirar o crédito %s: %s", l.ID, err.Error()))
+				continue
+			}
+			if ok {
+				expired++
+			}
+		}
+
+		if len(lots) < expiredLotsBatch {
+			break
+		}
+		last = &lots[len(lots)-1]
+	}
+
+	if failed > 0 {
+		return expired, fmt.Errorf("Erro ao expirar %d créditos vencidos", failed)
+	}
+
+	return expired, nil
+}
+
+// expireLot debita o que sobrou do crédito vencido; retorna false se ele já
+// foi consumido ou expirado
+func expireLot(db *gorm.DB, l CreditLot) (bool, error) {
+
+	expired := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+
+		a := &Account{}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Wallets").First(a, l.Account_id); result.Error != nil {
+			return errors.New("Erro ao consultar a conta do crédito vencido")
+		}
+
+		lot := &CreditLot{}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(lot, "id = ?", l.ID); result.Error != nil {
+			return errors.New("Erro ao consultar o crédito vencido")
+		}
+		if lot.Status != LotActive {
+			return nil
+		}
+
+		amount := lot.Remaining
+		if available := a.available(lot.Wallet); available < amount {
+			amount = available
+		}
+		if amount < 0 {
+			amount = 0
+		}
+
+		// sem saldo disponível o crédito expira sem lançamento
+		if amount > 0 {
+			if err := postEntries(tx, &lot.ID, "Expiração de crédito",
+				posting{account: a, wallet: lot.Wallet, amount: -amount},
+				posting{wallet: lot.Wallet, amount: amount},
+			); err != nil {
+				return err
+			}
+		}
+
+		lot.Expired = amount
+		lot.Remaining = 0
+		lot.Status = LotExpired
+		if result := tx.Save(lot); result.Error != nil {
+			return errors.New("Erro ao expirar o crédito")
+		}
+
+		expired = true
+		return nil
+	})
+
+	return expired, err
+}
+
+// ExpiringCredits retorna, por carteira, o valor dos créditos ainda não
+// consumidos que vence em cada data, da mais próxima para a mais distante
+func (a *Account) ExpiringCredits(db *gorm.DB, loc *time.Location) (map[string][]ExpiringAmount, error) {
+
+	var lots []CreditLot
+	if result := db.Where("account_id = ? AND status = ?", a.ID, LotActive).
+		Order("expires_at").
+		Find(&lots); result.Error != nil {
+		return nil, errors.New("Erro ao consultar os créditos com validade")
+	}
+
+	expiring := map[string][]ExpiringAmount{}
+	for _, l := range lots {
+		// o crédito vence no início do dia seguinte ao último dia de uso
+		date := l.Expires_at.In(loc).Add(-time.Nanosecond).Format("2006-01-02")
+
+		amounts := expiring[l.Wallet]
+		if n := len(amounts); n > 0 && amounts[n-1].Date == date {
+			amounts[n-1].Amount += l.Remaining
+		} else {
+			amounts = append(amounts, ExpiringAmount{Date: date, Amount: l.Remaining})
+		}
+		expiring[l.Wallet] = amounts
+	}
+
+	return expiring, nil
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// erros do cadastro de empregadores
+var (
+	ErrEmployerNotFound = errors.New("Empregador não encontrado")
+	ErrAccountNotFound  = errors.New("Conta não encontrada")
+)
+
+// Employer modelo da empresa que concede os benefícios creditados nas contas
+type Employer struct {
+	ID        int              `json:"id" gorm:"primaryKey"`
+	Name      string           `json:"name" validate:"required"`
+	CNPJ      string           `json:"cnpj" gorm:"unique" validate:"required,len=14,numeric"`
+	Schedules []CreditSchedule `json:"schedules" gorm:"foreignKey:Employer_id" validate:"dive"` // CRÉDITOS MENSAIS DO BENEFÍCIO
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	DeletedAt gorm.DeletedAt   `gorm:"index" json:"-"`
+}
+
+// CreditSchedule crédito mensal do empregador em uma carteira das contas
+// vinculadas, lançado no enésimo dia útil do mês
+type CreditSchedule struct {
+	ID           int            `json:"id" gorm:"primaryKey"`
+	Employer_id  int            `json:"employer_id" gorm:"not null;index"`
+	Wallet       string         `json:"wallet" gorm:"not null" validate:"required,category"`
+	Amount       money.Money    `json:"amount" gorm:"not null" validate:"gt=0"`
+	Business_day int            `json:"business_day" gorm:"not null" validate:"omitempty,min=1,max=20"`   // DIA ÚTIL DO MÊS, PADRÃO 1
+	Expiry_days  int            `json:"expiry_days" gorm:"not null;default:0" validate:"omitempty,min=1"` // VALIDADE DO CRÉDITO EM DIAS, 0 SEM VALIDADE
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// CreateEmployer cria o empregador com os seus créditos agendados
+func (e *Employer) CreateEmployer(app *app.App) (*Employer, error) {
+
+	employer := &Employer{
+		Name:      e.Name,
+		CNPJ:      e.CNPJ,
+		Schedules: []CreditSchedule{},
+	}
+	for _, s := range e.Schedules {
+		employer.Schedules = append(employer.Schedules, *s.normalize())
+	}
+
+	if result := app.DB.Client.Create(employer); result.Error != nil {
+		return nil, errors.New("Erro ao criar o empregador")
+	}
+
+	return employer, nil
+}
+
+// FindEmployer procura o empregador com os seus créditos agendados;
+// empregador inexistente retorna ErrEmployerNotFound
+func FindEmployer(app *app.App, id int) (*Employer, error) {
+
+	var employers []Employer
+	if result := app.DB.Client.Preload("Schedules").Where("id = ?", id).Limit(1).Find(&employers); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o empregador")
+	}
+	if len(employers) == 0 {
+		return nil, ErrEmployerNotFound
+	}
+
+	return &employers[0], nil
+}
+
+// LinkAccount vincula a conta ao empregador, que passa a creditar os seus
+// benefícios nela
+func (e *Employer) LinkAccount(app *app.App, accountID int) error {
+
+	result := app.DB.Client.Model(&Account{}).Where("id = ?", accountID).Updates(map[string]interface{}{
+		"employer_id": e.ID,
+		"version":     gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return errors.New("Erro ao vincular a conta ao empregador")
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// CreateCreditSchedule agenda um novo crédito mensal do empregador
+func (s *CreditSchedule) CreateCreditSchedule(app *app.App, employerID int) (*CreditSchedule, error) {
+
+	schedule := s.normalize()
+	schedule.Employer_id = employerID
+
+	if result := app.DB.Client.Create(schedule); result.Error != nil {
+		return nil, errors.New("Erro ao agendar o crédito do empregador")
+	}
+
+	return schedule, nil
+}
+
+// normalize copia os campos informados aplicando o dia útil padrão
+func (s *CreditSchedule) normalize() *CreditSchedule {
+	schedule := &CreditSchedule{
+		Wallet:       s.Wallet,
+		Amount:       s.Amount,
+		Business_day: s.Business_day,
+		Expiry_days:  s.Expiry_days,
+	}
+	if schedule.Business_day == 0 {
+		schedule.Business_day = 1
+	}
+	return schedule
+}
+
+// due retorna o início do dia em que o crédito do mês é devido
+func (s *CreditSchedule) due(year int, month time.Month, loc *time.Location) time.Time {
+	return businessDay(year, month, s.Business_day, loc)
+}
+
+// expires retorna o vencimento do crédito lançado em credited, no fim do
+// último dia de validade; nil quando o crédito não tem validade
+func (s *CreditSchedule) expires(credited time.Time) *time.Time {
+	if s.Expiry_days <= 0 {
+		return nil
+	}
+	last := credited.AddDate(0, 0, s.Expiry_days)
+	expires := expiresAfter(last.Year(), last.Month(), last.Day(), credited.Location())
+	return &expires
+}
+
+// businessDay retorna o enésimo dia útil do mês, desconsiderando fins de
+// semana e feriados nacionais; meses com menos dias úteis retornam o último
+func businessDay(year int, month time.Month, n int, loc *time.Location) time.Time {
+
+	day := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	last := day
+	for count := 0; day.Month() == month; day = day.AddDate(0, 0, 1) {
+		if !isBusinessDay(day) {
+			continue
+		}
+		last = day
+		count++
+		if count == n {
+			break
+		}
+	}
+
+	return last
+}
+
+// feriados nacionais de data fixa, no formato mês-dia
+var nationalHolidays = map[string]bool{
+	"01-01": true, // CONFRATERNIZAÇÃO UNIVERSAL
+	"04-21": true, // TIRADENTES
+	"05-01": true, // DIA DO TRABALHO
+	"09-07": true, // INDEPENDÊNCIA
+	"10-12": true, // NOSSA SENHORA APARECIDA
+	"11-02": true, // FINADOS
+	"11-15": true, // PROCLAMAÇÃO DA REPÚBLICA
+	"12-25": true, // NATAL
+}
+
+// isBusinessDay verifica se o dia não é fim de semana nem feriado nacional
+func isBusinessDay(day time.Time) bool {
+
+	switch day.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+
+	date := day.Format("01-02")
+	if nationalHolidays[date] {
+		return false
+	}
+
+	// consciência negra, feriado nacional a partir de 2024
+	if date == "11-20" && day.Year() >= 2024 {
+		return false
+	}
+
+	// sexta-feira santa, dois dias antes da páscoa
+	goodFriday := easter(day.Year(), day.Location()).AddDate(0, 0, -2)
+	return !(day.Month() == goodFriday.Month() && day.Day() == goodFriday.Day())
+}
+
+// easter calcula o domingo de páscoa do ano pelo algoritmo de Meeus/Jones/Butcher
+func easter(year int, loc *time.Location) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+}
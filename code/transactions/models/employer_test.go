@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusinessDay(t *testing.T) {
+
+	cases := []struct {
+		year  int
+		month time.Month
+		n     int
+		day   int
+	}{
+		{2021, time.January, 1, 4},    // 1º é feriado e 2 e 3 fim de semana
+		{2021, time.March, 1, 1},      // segunda-feira
+		{2021, time.May, 1, 3},        // 1º é sábado e feriado
+		{2021, time.April, 1, 1},      // quinta-feira
+		{2021, time.April, 2, 5},      // sexta-feira santa em 2 de abril
+		{2021, time.August, 5, 6},     // 2 a 6 de agosto
+		{2024, time.November, 13, 21}, // 15 e 20 de novembro são feriados
+		{2021, time.February, 30, 26}, // último dia útil do mês
+	}
+
+	for _, c := range cases {
+		got := businessDay(c.year, c.month, c.n, time.UTC)
+		if got.Month() != c.month || got.Day() != c.day {
+			t.Errorf("businessDay(%d, %s, %d): expected day %d. Got %s", c.year, c.month, c.n, c.day, got.Format("2006-01-02"))
+		}
+	}
+}
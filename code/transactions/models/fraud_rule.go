@@ -0,0 +1,357 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ações de uma regra antifraude disparada
+const (
+	FraudApprove = "approve" // APENAS REGISTRA A REGRA, SEM EFEITO NA AUTORIZAÇÃO
+	FraudDecline = "decline" // RECUSA A TRANSAÇÃO
+	FraudFlag    = "flag"    // APROVA E MARCA A TRANSAÇÃO PARA REVISÃO
+)
+
+// regras antifraude disponíveis
+const (
+	RuleVelocity         = "velocity"           // MAIS DE COUNT TRANSAÇÕES EM WINDOW MINUTOS
+	RuleRepeatedPurchase = "repeated_purchase"  // MESMO ESTABELECIMENTO E VALOR EM WINDOW MINUTOS
+	RuleAmountSpike      = "amount_spike"       // VALOR ACIMA DE FACTOR VEZES A MÉDIA DA CONTA
+	RuleNightMerchant    = "night_new_merchant" // ESTABELECIMENTO NOVO ENTRE NIGHT_START E NIGHT_END
+)
+
+// erros das regras antifraude
+var (
+	ErrFraudRuleNotFound = errors.New("Regra antifraude não encontrada")
+	ErrFraudRuleName     = errors.New("Regra antifraude desconhecida")
+)
+
+// FraudCheck verifica se a regra dispara para a transação t da conta a em now
+//
+// A conta está travada pela transação do banco recebida em tx; loc é o fuso
+// horário configurado.
+type FraudCheck func(tx *gorm.DB, r *FraudRule, t *Transaction, a *Account, now time.Time, loc *time.Location) (bool, error)
+
+// fraudChecks verificações registradas, pelo nome da regra
+var fraudChecks = map[string]FraudCheck{
+	RuleVelocity:         checkVelocity,
+	RuleRepeatedPurchase: checkRepeatedPurchase,
+	RuleAmountSpike:      checkAmountSpike,
+	RuleNightMerchant:    checkNightMerchant,
+}
+
+// RegisterFraudCheck registra uma nova verificação antifraude, que passa a
+// poder ser configurada pelas rotas administrativas com o nome informado
+func RegisterFraudCheck(name string, check FraudCheck) {
+	fraudChecks[name] = check
+}
+
+// FraudRule configuração de uma regra antifraude
+//
+// Cada regra usa apenas os parâmetros que fazem sentido para ela. A mesma
+// regra pode ser configurada mais de uma vez, com parâmetros e ações
+// diferentes.
+type FraudRule struct {
+	ID          int            `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null" validate:"required"`
+	Action      string         `json:"action" gorm:"not null" validate:"required,oneof=approve decline flag"`
+	Enabled     bool           `json:"enabled"`
+	Count       int            `json:"count,omitempty" validate:"gte=0"`              // QUANTIDADE DE TRANSAÇÕES
+	Window      int            `json:"window,omitempty" validate:"gte=0"`             // JANELA EM MINUTOS
+	Factor      float64        `json:"factor,omitempty" validate:"gte=0"`             // MULTIPLICADOR DA MÉDIA
+	Night_start int            `json:"night_start,omitempty" validate:"gte=0,lte=23"` // HORA DE INÍCIO DA MADRUGADA
+	Night_end   int            `json:"night_end,omitempty" validate:"gte=0,lte=23"`   // HORA DE FIM DA MADRUGADA
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TriggeredRule regra antifraude disparada em uma autorização
+type TriggeredRule struct {
+	ID             int       `json:"-" gorm:"primaryKey"`
+	Transaction_id uuid.UUID `json:"transaction_id" gorm:"type:uuid;not null;index"`
+	Rule_id        int       `json:"rule_id"`
+	Rule           string    `json:"rule" gorm:"not null"`
+	Action         string    `json:"action" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// defaultFraudRules regras criadas quando a tabela está vazia; todas apenas
+// marcam a transação, e passam a recusar quando a ação é trocada para decline
+var defaultFraudRules = []FraudRule{
+	{Name: RuleVelocity, Action: FraudFlag, Enabled: true, Count: 5, Window: 10},
+	{Name: RuleRepeatedPurchase, Action: FraudFlag, Enabled: true, Window: 2},
+	{Name: RuleAmountSpike, Action: FraudFlag, Enabled: true, Count: 5, Factor: 5, Window: 90 * 24 * 60},
+	{Name: RuleNightMerchant, Action: FraudFlag, Enabled: true, Night_start: 0, Night_end: 5},
+}
+
+// fraudCache cache em memória das regras antifraude habilitadas
+var fraudCache struct {
+	sync.RWMutex
+	loaded bool
+	rules  []FraudRule
+}
+
+// LoadFraudRules cria as regras padrão na inicialização, se a tabela
+// fraud_rules estiver vazia
+func LoadFraudRules(app *app.App) error {
+
+	var count int64
+	if result := app.DB.Client.Unscoped().Model(&FraudRule{}).Count(&count); result.Error != nil {
+		return errors.New("Erro ao consultar as regras antifraude")
+	}
+
+	if count == 0 {
+		rules := append([]FraudRule(nil), defaultFraudRules...)
+		if result := app.DB.Client.Create(&rules); result.Error != nil {
+			return errors.New("Erro ao carregar as regras antifraude")
+		}
+	}
+
+	InvalidateFraudRules()
+
+	return nil
+}
+
+// InvalidateFraudRules descarta o cache para que a próxima autorização releia a tabela
+func InvalidateFraudRules() {
+	fraudCache.Lock()
+	fraudCache.loaded = false
+	fraudCache.rules = nil
+	fraudCache.Unlock()
+}
+
+// cachedFraudRules retorna as regras habilitadas do cache, carregando do banco se necessário
+func cachedFraudRules(db *gorm.DB) ([]FraudRule, error) {
+
+	fraudCache.RLock()
+	if fraudCache.loaded {
+		rules := fraudCache.rules
+		fraudCache.RUnlock()
+		return rules, nil
+	}
+	fraudCache.RUnlock()
+
+	fraudCache.Lock()
+	defer fraudCache.Unlock()
+
+	if !fraudCache.loaded {
+		var rules []FraudRule
+		if result := db.Where("enabled").Order("id").Find(&rules); result.Error != nil {
+			return nil, errors.New("Erro ao consultar as regras antifraude")
+		}
+		fraudCache.rules = rules
+		fraudCache.loaded = true
+	}
+
+	return fraudCache.rules, nil
+}
+
+// Validate verifica se a regra está registrada
+func (r *FraudRule) Validate() error {
+	if _, ok := fraudChecks[r.Name]; !ok {
+		return ErrFraudRuleName
+	}
+	return nil
+}
+
+// CreateFraudRule cria uma regra antifraude e invalida o cache
+func (r *FraudRule) CreateFraudRule(app *app.App) (*FraudRule, error) {
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	rule := &FraudRule{
+		Name:        r.Name,
+		Action:      r.Action,
+		Enabled:     r.Enabled,
+		Count:       r.Count,
+		Window:      r.Window,
+		Factor:      r.Factor,
+		Night_start: r.Night_start,
+		Night_end:   r.Night_end,
+	}
+	if result := app.DB.Client.Create(rule); result.Error != nil {
+		return nil, errors.New("Erro ao criar a regra antifraude")
+	}
+
+	InvalidateFraudRules()
+
+	return rule, nil
+}
+
+// UpdateFraudRule atualiza a ação e os parâmetros da regra e invalida o cache
+func (r *FraudRule) UpdateFraudRule(app *app.App, id int) (*FraudRule, error) {
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	rule := &FraudRule{}
+	if result := app.DB.Client.Limit(1).Find(rule, id); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a regra antifraude")
+	} else if result.RowsAffected == 0 {
+		return nil, ErrFraudRuleNotFound
+	}
+
+	rule.Name = r.Name
+	rule.Action = r.Action
+	rule.Enabled = r.Enabled
+	rule.Count = r.Count
+	rule.Window = r.Window
+	rule.Factor = r.Factor
+	rule.Night_start = r.Night_start
+	rule.Night_end = r.Night_end
+
+	if result := app.DB.Client.Save(rule); result.Error != nil {
+		return nil, errors.New("Erro ao atualizar a regra antifraude")
+	}
+
+	InvalidateFraudRules()
+
+	return rule, nil
+}
+
+// DeleteFraudRule remove uma regra antifraude e invalida o cache
+func DeleteFraudRule(app *app.App, id int) error {
+
+	result := app.DB.Client.Delete(&FraudRule{}, id)
+	if result.Error != nil {
+		return errors.New("Erro ao remover a regra antifraude")
+	}
+	if result.RowsAffected == 0 {
+		return ErrFraudRuleNotFound
+	}
+
+	InvalidateFraudRules()
+
+	return nil
+}
+
+// screen executa as regras antifraude habilitadas, na ordem de criação, e
+// retorna as regras disparadas
+func (t *Transaction) screen(tx *gorm.DB, a *Account, now time.Time, loc *time.Location) ([]TriggeredRule, error) {
+
+	rules, err := cachedFraudRules(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var triggered []TriggeredRule
+	for i := range rules {
+		r := &rules[i]
+
+		check, ok := fraudChecks[r.Name]
+		if !ok {
+			continue
+		}
+
+		hit, err := check(tx, r, t, a, now, loc)
+		if err != nil {
+			return nil, err
+		}
+		if hit {
+			triggered = append(triggered, TriggeredRule{
+				Transaction_id: t.ID,
+				Rule_id:        r.ID,
+				Rule:           r.Name,
+				Action:         r.Action,
+			})
+		}
+	}
+
+	return triggered, nil
+}
+
+// screenedTransactions consulta as compras e pré-autorizações da conta
+func screenedTransactions(tx *gorm.DB, a *Account) *gorm.DB {
+	return tx.Model(&Transaction{}).
+		Where("account_id = ? AND type IN ?", a.ID, []string{TypePurchase, TypePreauth})
+}
+
+// checkVelocity dispara quando a conta já tem Count tentativas de compra,
+// aprovadas ou não, nos últimos Window minutos
+func checkVelocity(tx *gorm.DB, r *FraudRule, t *Transaction, a *Account, now time.Time, loc *time.Location) (bool, error) {
+
+	var count int64
+	if result := screenedTransactions(tx, a).
+		Where("created_at >= ?", now.Add(-time.Duration(r.Window)*time.Minute)).
+		Count(&count); result.Error != nil {
+		return false, errors.New("Erro ao consultar as transações recentes da conta")
+	}
+
+	return count >= int64(r.Count), nil
+}
+
+// checkRepeatedPurchase dispara quando uma compra aprovada no mesmo
+// estabelecimento e com o mesmo valor aconteceu nos últimos Window minutos
+func checkRepeatedPurchase(tx *gorm.DB, r *FraudRule, t *Transaction, a *Account, now time.Time, loc *time.Location) (bool, error) {
+
+	var count int64
+	if result := screenedTransactions(tx, a).
+		Where("merchant = ? AND amount = ? AND code = ?", t.Merchant, t.Amount, CodeApproved).
+		Where("created_at >= ?", now.Add(-time.Duration(r.Window)*time.Minute)).
+		Count(&count); result.Error != nil {
+		return false, errors.New("Erro ao consultar as transações recentes da conta")
+	}
+
+	return count > 0, nil
+}
+
+// checkAmountSpike dispara quando o valor passa de Factor vezes a média das
+// compras aprovadas da conta nos últimos Window minutos; contas com menos de
+// Count compras na janela não têm média confiável e não disparam
+func checkAmountSpike(tx *gorm.DB, r *FraudRule, t *Transaction, a *Account, now time.Time, loc *time.Location) (bool, error) {
+
+	history := struct {
+		Count   int64
+		Average money.Money
+	}{}
+	if result := screenedTransactions(tx, a).
+		Select("COUNT(*) AS count, COALESCE(ROUND(AVG(amount), 2), 0) AS average").
+		Where("code = ? AND created_at >= ?", CodeApproved, now.Add(-time.Duration(r.Window)*time.Minute)).
+		Scan(&history); result.Error != nil {
+		return false, errors.New("Erro ao consultar a média das transações da conta")
+	}
+
+	if history.Count == 0 || history.Count < int64(r.Count) {
+		return false, nil
+	}
+
+	return float64(t.Amount) > r.Factor*float64(history.Average), nil
+}
+
+// checkNightMerchant dispara para um estabelecimento em que a conta nunca
+// comprou quando a hora local está entre Night_start e Night_end
+func checkNightMerchant(tx *gorm.DB, r *FraudRule, t *Transaction, a *Account, now time.Time, loc *time.Location) (bool, error) {
+
+	if !r.night(now.In(loc).Hour()) {
+		return false, nil
+	}
+
+	var count int64
+	if result := screenedTransactions(tx, a).
+		Where("merchant = ? AND code = ?", t.Merchant, CodeApproved).
+		Count(&count); result.Error != nil {
+		return false, errors.New("Erro ao consultar os estabelecimentos da conta")
+	}
+
+	return count == 0, nil
+}
+
+// night indica se a hora está entre Night_start (inclusive) e Night_end
+func (r *FraudRule) night(hour int) bool {
+	if r.Night_start > r.Night_end {
+		// madrugada que começa antes da meia-noite, por exemplo das 22h às 5h
+		return hour >= r.Night_start || hour < r.Night_end
+	}
+	return hour >= r.Night_start && hour < r.Night_end
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestFraudRuleNight(t *testing.T) {
+
+	cases := []struct {
+		start, end, hour int
+		expected         bool
+	}{
+		{0, 5, 0, true},
+		{0, 5, 4, true},
+		{0, 5, 5, false},
+		{0, 5, 23, false},
+		{22, 5, 23, true}, // madrugada que começa antes da meia-noite
+		{22, 5, 3, true},
+		{22, 5, 12, false},
+		{3, 3, 3, false},
+	}
+
+	for _, c := range cases {
+		r := &FraudRule{Night_start: c.start, Night_end: c.end}
+		if got := r.night(c.hour); got != c.expected {
+			t.Errorf("night(%d) de %dh a %dh: expected %v. Got %v", c.hour, c.start, c.end, c.expected, got)
+		}
+	}
+}
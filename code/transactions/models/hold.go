@@ -0,0 +1,329 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// situação do bloqueio de uma pré-autorização
+const (
+	HoldActive   = "active"   // SALDO BLOQUEADO AGUARDANDO CAPTURA
+	HoldCaptured = "captured" // CAPTURADA, TOTAL OU PARCIALMENTE
+	HoldVoided   = "voided"   // CANCELADA PELO ESTABELECIMENTO
+	HoldExpired  = "expired"  // LIBERADA PELO JOB DE EXPIRAÇÃO
+)
+
+// quantidade de bloqueios expirados liberados por consulta
+const expiredHoldsBatch = 100
+
+// erros da captura e do cancelamento
+var (
+	ErrHoldNotFound  = errors.New("Pré-autorização não encontrada")
+	ErrHoldNotActive = errors.New("Pré-autorização já capturada, cancelada ou expirada")
+	ErrCaptureAmount = errors.New("Valor da captura deve ser positivo e até o valor pré-autorizado")
+)
+
+// Hold bloqueio de saldo de uma pré-autorização aprovada
+//
+// O valor bloqueado continua no saldo contábil da carteira (balance), mas sai
+// do saldo disponível (balance - held) até a captura, o cancelamento ou a
+// expiração.
+type Hold struct {
+	ID             int         `json:"-" gorm:"primaryKey"`
+	Transaction_id uuid.UUID   `json:"transaction_id" gorm:"type:uuid;not null;uniqueIndex"` // PRÉ-AUTORIZAÇÃO DE ORIGEM
+	Account_id     int         `json:"account_id" gorm:"not null;index"`
+	Wallet         string      `json:"wallet" gorm:"not null"`
+	Amount         money.Money `json:"amount" gorm:"not null"`
+	Captured       money.Money `json:"captured" gorm:"not null;default:0"`
+	Status         string      `json:"status" gorm:"not null;index:idx_holds_status_expires"`
+	Expires_at     time.Time   `json:"expires_at" gorm:"not null;index:idx_holds_status_expires"`
+	CreatedAt      time.Time   `json:"created"`
+	UpdatedAt      time.Time   `json:"updated"`
+}
+
+// placeHold bloqueia o valor da pré-autorização na carteira aprovada
+//
+// A conta deve estar travada pela transação do banco recebida em tx.
+func (t *Transaction) placeHold(tx *gorm.DB, origem *Account, ttl time.Duration) error {
+
+	hold := &Hold{
+		Transaction_id: t.ID,
+		Account_id:     origem.ID,
+		Wallet:         t.Wallet,
+		Amount:         t.Amount,
+		Status:         HoldActive,
+		Expires_at:     time.Now().Add(ttl),
+	}
+	if result := tx.Create(hold); result.Error != nil {
+		return errors.New("Erro ao bloquear o saldo da pré-autorização")
+	}
+
+	if err := origem.updateHeld(tx, t.Wallet, t.Amount); err != nil {
+		return errors.New("Erro ao bloquear o saldo da conta de origem-" + t.Wallet)
+	}
+
+	return nil
+}
+
+// CaptureTransaction captura a pré-autorização id no valor informado; valor
+// zero captura o total
+//
+// O valor capturado é debitado da carteira bloqueada e creditado no destino,
+// e o restante do bloqueio é liberado: só há uma captura por pré-autorização.
+// A conta informada deve ser a de destino da pré-autorização; zero indica o
+// operador.
+func CaptureTransaction(ctx context.Context, app *app.App, id uuid.UUID, accountID int, amount money.Money) (*Transaction, error) {
+	return settleHold(ctx, app, id, accountID, func(tx *gorm.DB, hold *Hold, t *Transaction, origem, destino *Account) error {
+
+		if amount == 0 {
+			amount = hold.Amount
+		}
+		if amount < 0 || amount > hold.Amount {
+			return ErrCaptureAmount
+		}
+
+		t.Type = TypeCapture
+		t.Amount = amount
+		t.approve(hold.Wallet, "Captura autorizada")
+
+		hold.Status = HoldCaptured
+		hold.Captured = amount
+
+		// debita a origem e credita o destino com o valor capturado
+		return t.transfer(tx, origem, destino, "Captura "+t.Merchant)
+	})
+}
+
+// VoidTransaction cancela a pré-autorização id, liberando todo o bloqueio
+//
+// A conta informada deve ser a de destino da pré-autorização; zero indica o
+// operador.
+func VoidTransaction(ctx context.Context, app *app.App, id uuid.UUID, accountID int) (*Transaction, error) {
+	return settleHold(ctx, app, id, accountID, func(tx *gorm.DB, hold *Hold, t *Transaction, origem, destino *Account) error {
+
+		t.Type = TypeVoid
+		t.Amount = hold.Amount
+		t.approve(hold.Wallet, "Pré-autorização cancelada")
+
+		hold.Status = HoldVoided
+		return nil
+	})
+}
+
+// settleHold encerra o bloqueio da pré-autorização id e registra a transação
+// de captura ou de cancelamento, vinculada à original por Parent_id
+//
+// As contas são travadas na mesma ordem da autorização e depois o bloqueio,
+// de forma que captura, cancelamento e expiração concorrentes encerram o
+// bloqueio uma única vez.
+func settleHold(ctx context.Context, app *app.App, id uuid.UUID, accountID int, settle func(tx *gorm.DB, hold *Hold, t *Transaction, origem, destino *Account) error) (*Transaction, error) {
+
+	db := app.DB.Client.WithContext(ctx)
+
+	// procura a pré-autorização aprovada
+	parent := &Transaction{}
+	if result := db.Where("id = ? AND type = ?", id, TypePreauth).Limit(1).Find(parent); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a pré-autorização")
+	} else if result.RowsAffected == 0 || !parent.Approved() {
+		return nil, ErrHoldNotFound
+	}
+	// só o estabelecimento creditado ou o operador encerram o bloqueio
+	if accountID != 0 && parent.Accounttocredit_id != accountID {
+		return nil, ErrHoldNotFound
+	}
+
+	t := &Transaction{
+		ID:                 uuid.New(),
+		Parent_id:          &parent.ID,
+		Account_id:         parent.Account_id,
+		Accounttocredit_id: parent.Accounttocredit_id,
+		Merchant:           parent.Merchant,
+		Merchant_id:        parent.Merchant_id,
+		Mcc:                parent.Mcc,
+		Effective_mcc:      parent.Effective_mcc,
+		Wallet:             parent.Wallet,
+	}
+
+	// inicia o modo de transaction
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, errors.New("Erro ao encerrar a pré-autorização")
+	}
+
+	transaction, err := t.closeHold(tx, id, settle)
+	if err != nil {
+
+		// caso ocorra erro faz rollback
+		tx.Rollback()
+		return nil, err
+	}
+
+	// transação sem erros é comitada
+	if err := tx.Commit(); err.Error != nil {
+		return nil, errors.New("Erro ao encerrar a pré-autorização")
+	}
+
+	return transaction, nil
+}
+
+// closeHold trava as contas e o bloqueio, aplica settle e registra t
+func (t *Transaction) closeHold(tx *gorm.DB, id uuid.UUID, settle func(tx *gorm.DB, hold *Hold, t *Transaction, origem, destino *Account) error) (*Transaction, error) {
+
+	// trava as contas de origem e destino
+	origem, destino, err := t.lockAccounts(tx)
+	if err != nil {
+		return nil, err
+	}
+	if origem == nil || destino == nil {
+		return nil, errors.New("Conta da pré-autorização não encontrada")
+	}
+
+	// trava o bloqueio, que só pode ser encerrado uma vez
+	hold, err := lockHold(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status != HoldActive || !hold.Expires_at.After(time.Now()) {
+		return nil, ErrHoldNotActive
+	}
+
+	// libera o bloqueio antes de debitar o valor capturado
+	if err := origem.updateHeld(tx, hold.Wallet, -hold.Amount); err != nil {
+		return nil, errors.New("Erro ao liberar o saldo bloqueado")
+	}
+
+	if err := settle(tx, hold, t, origem, destino); err != nil {
+		return nil, err
+	}
+
+	if result := tx.Save(hold); result.Error != nil {
+		return nil, errors.New("Erro ao encerrar a pré-autorização")
+	}
+	if result := tx.Create(t); result.Error != nil {
+		return nil, errors.New("Erro na criação da transação")
+	}
+	if err := linkIdempotency(tx, t.ID); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// lockHold trava o bloqueio da pré-autorização; bloqueio inexistente é nil
+func lockHold(tx *gorm.DB, id uuid.UUID) (*Hold, error) {
+
+	var holds []Hold
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("transaction_id = ?", id).
+		Limit(1).
+		Find(&holds); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o bloqueio da pré-autorização")
+	}
+	if len(holds) == 0 {
+		return nil, nil
+	}
+
+	return &holds[0], nil
+}
+
+// ReleaseExpiredHolds libera o saldo das pré-autorizações vencidas sem
+// captura e retorna quantas foram liberadas
+//
+// Cada bloqueio é liberado em uma transação própria, com a conta e o
+// bloqueio travados; um bloqueio capturado ou cancelado nesse meio tempo é
+// ignorado. Um bloqueio com erro é registrado no log e fica para a próxima
+// execução, sem impedir a liberação dos demais.
+func ReleaseExpiredHolds(app *app.App) (int, error) {
+
+	released, failed := 0, 0
+	now := time.Now()
+
+	// continua depois do último bloqueio do lote anterior, de forma que um
+	// bloqueio com erro não volta no lote seguinte
+	var last *Hold
+	for {
+		query := app.DB.Client.Where("status = ? AND expires_at <= ?", HoldActive, now)
+		if last != nil {
+			query = query.Where("(expires_at, id) > (?, ?)", last.Expires_at, last.ID)
+		}
+
+		var holds []Hold
+		if result := query.
+			Order("expires_at").
+			Order("id").
+			Limit(expiredHoldsBatch).
+			Find(&holds); result.Error != nil {
+			return released, errors.New("Erro ao consultar as pré-autorizações vencidas")
+		}
+
+		for _, h := range holds {
+			ok, err := releaseHold(app.DB.Client, h)
+			if err != nil {
+				failed++
+				app.Log.Error(fmt.Sprintf("Erro ao liberar a pré-autorização %s: %s", h.Transaction_id, err.Error()))
+				continue
+			}
+			if ok {
+				released++
+			}
+		}
+
+		if len(holds) < expiredHoldsBatch {
+			break
+		}
+		last = &holds[len(holds)-1]
+	}
+
+	if failed > 0 {
+		return released, fmt.Errorf("Erro ao liberar %d pré-autorizações vencidas", failed)
+	}
+
+	return released, nil
+}
+
+// releaseHold libera um bloqueio vencido; retorna false se ele já foi encerrado
+func releaseHold(db *gorm.DB, h Hold) (bool, error) {
+
+	released := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+
+		a := &Account{}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(a, h.Account_id); result.Error != nil {
+			return errors.New("Erro ao consultar a conta da pré-autorização")
+		}
+
+		hold, err := lockHold(tx, h.Transaction_id)
+		if err != nil {
+			return err
+		}
+		if hold == nil || hold.Status != HoldActive {
+			return nil
+		}
+
+		if err := a.updateHeld(tx, hold.Wallet, -hold.Amount); err != nil {
+			return errors.New("Erro ao liberar o saldo bloqueado")
+		}
+
+		hold.Status = HoldExpired
+		if result := tx.Save(hold); result.Error != nil {
+			return errors.New("Erro ao liberar a pré-autorização")
+		}
+
+		released = true
+		return nil
+	})
+
+	return released, err
+}
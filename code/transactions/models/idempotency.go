@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"cajueiro/pkg/app"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tempo após o qual uma chave em processamento é considerada abandonada
+const idempotencyStaleAfter = time.Minute
+
+// erros da verificação de idempotência
+var (
+	ErrIdempotencyConflict   = errors.New("Chave de idempotência já utilizada com outro conteúdo")
+	ErrIdempotencyInProgress = errors.New("Request com a mesma chave de idempotência em processamento")
+)
+
+// IdempotencyKey modelo da chave de idempotência e da resposta armazenada do request
+type IdempotencyKey struct {
+	ID             int    `gorm:"primaryKey"`
+	Account_id     int    `gorm:"not null;uniqueIndex:idx_idempotency_account_key"`
+	Key            string `gorm:"not null;size:255;uniqueIndex:idx_idempotency_account_key"`
+	Request_hash   string `gorm:"not null"`
+	Status_code    int    // ZERO ENQUANTO O REQUEST ESTÁ EM PROCESSAMENTO
+	Content_type   string
+	Response       []byte     // CORPO DA RESPOSTA ORIGINAL
+	Transaction_id *uuid.UUID `gorm:"type:uuid"` // TRANSAÇÃO GRAVADA PELO REQUEST, NA MESMA TRANSAÇÃO DO BANCO
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// RequestHash calcula o hash que identifica o conteúdo do request
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// BeginIdempotency reserva a chave de idempotência da conta
+//
+// Se a chave for nova ela é gravada em processamento e retornada com
+// Status_code zero. Se já existir com a resposta armazenada, a chave é
+// retornada para que a resposta original seja repetida; com outro conteúdo
+// retorna ErrIdempotencyConflict e ainda em processamento ErrIdempotencyInProgress.
+//
+// Uma chave em processamento há mais de idempotencyStaleAfter é assumida pelo
+// novo request. Se o request anterior chegou a gravar a transação, a chave
+// volta com Transaction_id preenchido e a transação deve ser repetida em vez
+// de autorizada de novo.
+func BeginIdempotency(app *app.App, accountID int, key, hash string) (*IdempotencyKey, error) {
+
+	k := &IdempotencyKey{Account_id: accountID, Key: key, Request_hash: hash}
+
+	result := app.DB.Client.Clauses(clause.OnConflict{DoNothing: true}).Create(k)
+	if result.Error != nil {
+		return nil, errors.New("Erro ao registrar a chave de idempotência")
+	}
+	if result.RowsAffected == 1 {
+		return k, nil
+	}
+
+	// a chave já existe
+	k = &IdempotencyKey{}
+	if result := app.DB.Client.First(&k, "account_id = ? AND key = ?", accountID, key); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a chave de idempotência")
+	}
+
+	if k.Request_hash != hash {
+		return nil, ErrIdempotencyConflict
+	}
+
+	if k.Status_code == 0 {
+		// assume a chave abandonada por um request que não terminou
+		result := app.DB.Client.Model(&IdempotencyKey{}).
+			Where("id = ? AND status_code = 0 AND updated_at < ?", k.ID, time.Now().Add(-idempotencyStaleAfter)).
+			Update("updated_at", time.Now())
+		if result.Error != nil {
+			return nil, errors.New("Erro ao registrar a chave de idempotência")
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrIdempotencyInProgress
+		}
+	}
+
+	return k, nil
+}
+
+// idempotencyContextKey chave do contexto que carrega a chave de idempotência
+type idempotencyContextKey struct{}
+
+// WithIdempotencyKey retorna uma cópia de ctx com a chave de idempotência k;
+// a transação gravada com esse contexto fica vinculada à chave
+func WithIdempotencyKey(ctx context.Context, k *IdempotencyKey) context.Context {
+	return context.WithValue(ctx, idempotencyContextKey{}, k)
+}
+
+// linkIdempotency vincula a transação id à chave de idempotência do contexto
+// de tx, dentro da mesma transação do banco que grava a autorização
+func linkIdempotency(tx *gorm.DB, id uuid.UUID) error {
+
+	k, ok := tx.Statement.Context.Value(idempotencyContextKey{}).(*IdempotencyKey)
+	if !ok {
+		return nil
+	}
+
+	if result := tx.Model(&IdempotencyKey{}).Where("id = ?", k.ID).Update("transaction_id", id); result.Error != nil {
+		return errors.New("Erro ao vincular a transação à chave de idempotência")
+	}
+	k.Transaction_id = &id
+
+	return nil
+}
+
+// Transaction retorna a transação gravada pelo request da chave; nil se o
+// request não chegou a gravá-la
+func (k *IdempotencyKey) Transaction(app *app.App) (*Transaction, error) {
+
+	if k.Transaction_id == nil {
+		return nil, nil
+	}
+
+	var transactions []Transaction
+	if result := app.DB.Client.Where("id = ?", *k.Transaction_id).Limit(1).Find(&transactions); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a transação da chave de idempotência")
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	return &transactions[0], nil
+}
+
+// CompleteIdempotency armazena a resposta do request; respostas de erro do
+// servidor (5xx) liberam a chave para que o request possa ser repetido
+//
+// A recusa por tempo ("91", 504 Gateway Timeout) é a exceção: o prazo pode ter
+// vencido durante o COMMIT, com o débito já aplicado, então a chave guarda a
+// recusa e a nova tentativa precisa de outra chave.
+func (k *IdempotencyKey) CompleteIdempotency(app *app.App, status int, contentType string, response []byte) error {
+
+	if status >= 500 && status != http.StatusGatewayTimeout {
+		if result := app.DB.Client.Delete(k); result.Error != nil {
+			return errors.New("Erro ao liberar a chave de idempotência")
+		}
+		return nil
+	}
+
+	k.Status_code = status
+	k.Content_type = contentType
+	k.Response = response
+	if result := app.DB.Client.Model(k).Updates(map[string]interface{}{
+		"status_code":  status,
+		"content_type": contentType,
+		"response":     response,
+	}); result.Error != nil {
+		return errors.New("Erro ao armazenar a resposta idempotente")
+	}
+
+	return nil
+}
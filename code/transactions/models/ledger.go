@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExternalAccount conta de contrapartida dos valores que entram ou saem do
+// sistema (saldo inicial, créditos do empregador, expirações)
+const ExternalAccount = 0
+
+// LedgerEntry lançamento do livro-razão de uma carteira
+//
+// A tabela é somente de inserção: cada movimentação grava lançamentos que
+// somam zero, um crédito (valor positivo) para cada débito (valor negativo).
+// O saldo das carteiras em wallets é um cache da soma dos lançamentos.
+type LedgerEntry struct {
+	ID             int64       `json:"-" gorm:"primaryKey"`
+	Transaction_id *uuid.UUID  `json:"transaction_id,omitempty" gorm:"type:uuid;index"` // TRANSAÇÃO QUE GEROU O LANÇAMENTO
+	Account_id     int         `json:"account_id" gorm:"not null;index:idx_ledger_account_wallet;index:idx_ledger_account_created"`
+	Wallet         string      `json:"wallet" gorm:"not null;index:idx_ledger_account_wallet"`
+	Amount         money.Money `json:"amount" gorm:"not null"`  // POSITIVO CRÉDITO, NEGATIVO DÉBITO
+	Balance        money.Money `json:"balance" gorm:"not null"` // SALDO DA CARTEIRA APÓS O LANÇAMENTO
+	Description    string      `json:"description"`
+	CreatedAt      time.Time   `json:"created" gorm:"index:idx_ledger_account_created"`
+}
+
+// posting lançamento a ser gravado; conta nil é a contrapartida externa
+type posting struct {
+	account *Account
+	wallet  string
+	amount  money.Money
+}
+
+// postEntries grava lançamentos balanceados no livro-razão e atualiza o saldo
+// em cache das carteiras
+//
+// As contas devem estar travadas pela transação do banco recebida em tx e
+// com as carteiras carregadas. Lançamentos que não somam zero são rejeitados.
+func postEntries(tx *gorm.DB, transactionID *uuid.UUID, description string, postings ...posting) error {
+
+	var sum money.Money
+	for _, p := range postings {
+		sum += p.amount
+	}
+	if sum != 0 {
+		return errors.New("Lançamentos não balanceados")
+	}
+
+	now := time.Now()
+	entries := make([]LedgerEntry, 0, len(postings))
+	for _, p := range postings {
+		if p.amount == 0 {
+			continue
+		}
+
+		entry := LedgerEntry{
+			Transaction_id: transactionID,
+			Account_id:     ExternalAccount,
+			Wallet:         p.wallet,
+			Amount:         p.amount,
+			Description:    description,
+			CreatedAt:      now,
+		}
+
+		// a contrapartida externa não tem carteira nem saldo
+		if p.account != nil {
+			if err := p.account.updateBalance(tx, p.wallet, p.amount); err != nil {
+				return err
+			}
+			entry.Account_id = p.account.ID
+			entry.Balance = p.account.walletBalance(p.wallet)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+	if result := tx.Create(&entries); result.Error != nil {
+		return errors.New("Erro ao gravar os lançamentos")
+	}
+
+	return nil
+}
+
+// transfer lança o valor da transação da carteira de from para a mesma
+// carteira de to
+//
+// O débito consome primeiro os créditos com validade da carteira de from.
+func (t *Transaction) transfer(tx *gorm.DB, from, to *Account, description string) error {
+	if err := from.consumeLots(tx, t.Wallet, t.Amount, t.ID); err != nil {
+		return err
+	}
+	return postEntries(tx, &t.ID, description,
+		posting{account: from, wallet: t.Wallet, amount: -t.Amount},
+		posting{account: to, wallet: t.Wallet, amount: t.Amount},
+	)
+}
+
+// WalletMismatch carteira cujo saldo em cache difere da soma dos lançamentos
+type WalletMismatch struct {
+	Account_id int         `json:"account_id"`
+	Wallet     string      `json:"wallet"`
+	Balance    money.Money `json:"balance"`
+	Ledger     money.Money `json:"ledger"`
+}
+
+// LedgerCheck resultado da verificação de consistência do livro-razão
+type LedgerCheck struct {
+	Consistent bool             `json:"consistent"`
+	Total      money.Money      `json:"total"`      // SOMA DE TODOS OS LANÇAMENTOS, DEVE SER ZERO
+	Unbalanced []uuid.UUID      `json:"unbalanced"` // TRANSAÇÕES CUJOS LANÇAMENTOS NÃO SOMAM ZERO
+	Mismatched []WalletMismatch `json:"mismatched"` // CARTEIRAS COM SALDO DIFERENTE DO LIVRO-RAZÃO
+}
+
+// CheckLedger verifica se os lançamentos somam zero no total e por
+// transação e se o saldo em cache de cada carteira é a soma dos seus
+// lançamentos
+func CheckLedger(db *gorm.DB) (*LedgerCheck, error) {
+
+	check := &LedgerCheck{Unbalanced: []uuid.UUID{}, Mismatched: []WalletMismatch{}}
+
+	if err := db.Model(&LedgerEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Row().Scan(&check.Total); err != nil {
+		return nil, errors.New("Erro ao somar os lançamentos")
+	}
+
+	if result := db.Model(&LedgerEntry{}).
+		Where("transaction_id IS NOT NULL").
+		Group("transaction_id").
+		Having("SUM(amount) <> 0").
+		Pluck("transaction_id", &check.Unbalanced); result.Error != nil {
+		return nil, errors.New("Erro ao conferir os lançamentos por transação")
+	}
+
+	rows, err := db.Raw(`SELECT w.account_id, w.category, w.balance, COALESCE(SUM(l.amount), 0)
+		FROM wallets w
+		LEFT JOIN ledger_entries l ON l.account_id = w.account_id AND l.wallet = w.category
+		GROUP BY w.account_id, w.category, w.balance
+		HAVING w.balance <> COALESCE(SUM(l.amount), 0)
+		ORDER BY w.account_id, w.category`).Rows()
+	if err != nil {
+		return nil, errors.New("Erro ao conferir o saldo das carteiras")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m WalletMismatch
+		if err := rows.Scan(&m.Account_id, &m.Wallet, &m.Balance, &m.Ledger); err != nil {
+			return nil, errors.New("Erro ao conferir o saldo das carteiras")
+		}
+		check.Mismatched = append(check.Mismatched, m)
+	}
+
+	check.Consistent = check.Total == 0 && len(check.Unbalanced) == 0 && len(check.Mismatched) == 0
+	return check, nil
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"cajueiro/pkg/app"
+
+	"gorm.io/gorm"
+)
+
+// MccCategory modelo do mapeamento de um mcc (ou faixa de mcc) para a categoria da carteira
+type MccCategory struct {
+	ID        int            `json:"id" gorm:"primaryKey"`
+	Mcc_from  string         `json:"mcc_from" gorm:"size:4;index" validate:"required,len=4,numeric"`
+	Mcc_to    string         `json:"mcc_to" gorm:"size:4" validate:"omitempty,len=4,numeric"`
+	Category  string         `json:"category" validate:"required,category"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// defaultMccCategories mapeamento usado quando não há tabela nem arquivo configurado
+var defaultMccCategories = []MccCategory{
+	{Mcc_from: "5411", Mcc_to: "5412", Category: WalletFood},
+	{Mcc_from: "5811", Mcc_to: "5812", Category: WalletMeal},
+}
+
+// mccCache cache em memória da tabela mcc_categories
+var mccCache struct {
+	sync.RWMutex
+	loaded     bool
+	categories []MccCategory
+}
+
+// LoadMccCategories popula a tabela mcc_categories na inicialização
+//
+// Se a tabela estiver vazia ela é preenchida com o arquivo de MCC_CATEGORIES_FILE
+// ou, sem arquivo, com o mapeamento padrão de food e meal. Com a tabela já
+// preenchida as alterações feitas pelas rotas administrativas são mantidas.
+func LoadMccCategories(app *app.App) error {
+
+	var count int64
+	if result := app.DB.Client.Model(&MccCategory{}).Count(&count); result.Error != nil {
+		return errors.New("Erro ao consultar as categorias de mcc")
+	}
+
+	if count == 0 {
+		categories := append([]MccCategory(nil), defaultMccCategories...)
+
+		file, err := app.Cfg.GetMccCategories()
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			categories = make([]MccCategory, 0, len(file))
+			for _, c := range file {
+				m := MccCategory{Mcc_from: c.From, Mcc_to: c.To, Category: c.Category}
+				if c.Mcc != "" {
+					m.Mcc_from, m.Mcc_to = c.Mcc, c.Mcc
+				}
+				if err := app.Vld.Struct(m); err != nil || m.Validate() != nil {
+					return errors.New("Categoria de mcc inválida no arquivo: " + c.Mcc + c.From)
+				}
+				categories = append(categories, m)
+			}
+		}
+
+		if len(categories) > 0 {
+			if result := app.DB.Client.Create(&categories); result.Error != nil {
+				return errors.New("Erro ao carregar as categorias de mcc")
+			}
+		}
+	}
+
+	InvalidateMccCategories()
+
+	return nil
+}
+
+// InvalidateMccCategories descarta o cache para que a próxima autorização releia a tabela
+func InvalidateMccCategories() {
+	mccCache.Lock()
+	mccCache.loaded = false
+	mccCache.categories = nil
+	mccCache.Unlock()
+}
+
+// ResolveMccCategory retorna a categoria da carteira para o mcc informado
+//
+// Quando mais de uma faixa contém o mcc vale a mais estreita; mcc sem
+// mapeamento usa a carteira de cash.
+func ResolveMccCategory(db *gorm.DB, mcc string) (string, error) {
+
+	categories, err := cachedMccCategories(db)
+	if err != nil {
+		return "", err
+	}
+
+	category := WalletCash
+	width := -1
+	for _, c := range categories {
+		if len(mcc) != len(c.Mcc_from) || mcc < c.Mcc_from || mcc > c.Mcc_to {
+			continue
+		}
+		if w := c.width(); width < 0 || w < width {
+			category, width = c.Category, w
+		}
+	}
+
+	return category, nil
+}
+
+// cachedMccCategories retorna a tabela do cache, carregando do banco se necessário
+func cachedMccCategories(db *gorm.DB) ([]MccCategory, error) {
+
+	mccCache.RLock()
+	if mccCache.loaded {
+		categories := mccCache.categories
+		mccCache.RUnlock()
+		return categories, nil
+	}
+	mccCache.RUnlock()
+
+	mccCache.Lock()
+	defer mccCache.Unlock()
+
+	if !mccCache.loaded {
+		var categories []MccCategory
+		if result := db.Find(&categories); result.Error != nil {
+			return nil, errors.New("Erro ao consultar as categorias de mcc")
+		}
+		mccCache.categories = categories
+		mccCache.loaded = true
+	}
+
+	return mccCache.categories, nil
+}
+
+// Validate preenche o fim da faixa quando for um único mcc e verifica a faixa
+func (m *MccCategory) Validate() error {
+	if m.Mcc_to == "" {
+		m.Mcc_to = m.Mcc_from
+	}
+	if m.Mcc_to < m.Mcc_from {
+		return errors.New("Faixa de mcc inválida")
+	}
+	return nil
+}
+
+// width retorna a largura da faixa de mcc
+func (m *MccCategory) width() int {
+	w := 0
+	for i := range m.Mcc_from {
+		w = w*10 + int(m.Mcc_to[i]) - int(m.Mcc_from[i])
+	}
+	return w
+}
+
+// CreateMccCategory cria um mapeamento de mcc e invalida o cache
+func (m *MccCategory) CreateMccCategory(app *app.App) (*MccCategory, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	category := &MccCategory{
+		Mcc_from: m.Mcc_from,
+		Mcc_to:   m.Mcc_to,
+		Category: m.Category,
+	}
+
+	if result := app.DB.Client.Create(category); result.Error != nil {
+		return nil, errors.New("Erro ao criar a categoria de mcc")
+	}
+
+	InvalidateMccCategories()
+
+	return category, nil
+}
+
+// UpdateMccCategory atualiza um mapeamento de mcc e invalida o cache
+func (m *MccCategory) UpdateMccCategory(app *app.App, id int) (*MccCategory, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	category := &MccCategory{}
+	if result := app.DB.Client.First(&category, id); result.Error != nil {
+		return nil, errors.New("Categoria de mcc não encontrada")
+	}
+
+	category.Mcc_from = m.Mcc_from
+	category.Mcc_to = m.Mcc_to
+	category.Category = m.Category
+
+	if result := app.DB.Client.Save(category); result.Error != nil {
+		return nil, errors.New("Erro ao atualizar a categoria de mcc")
+	}
+
+	InvalidateMccCategories()
+
+	return category, nil
+}
+
+// DeleteMccCategory remove um mapeamento de mcc e invalida o cache
+func DeleteMccCategory(app *app.App, id int) error {
+
+	result := app.DB.Client.Delete(&MccCategory{}, id)
+	if result.Error != nil {
+		return errors.New("Erro ao remover a categoria de mcc")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("Categoria de mcc não encontrada")
+	}
+
+	InvalidateMccCategories()
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestResolveMccCategory(t *testing.T) {
+
+	mccCache.Lock()
+	mccCache.loaded = true
+	mccCache.categories = []MccCategory{
+		{Mcc_from: "5411", Mcc_to: "5412", Category: WalletFood},
+		{Mcc_from: "5811", Mcc_to: "5812", Category: WalletMeal},
+		{Mcc_from: "4000", Mcc_to: "4999", Category: WalletFood},
+		{Mcc_from: "4121", Mcc_to: "4121", Category: WalletMeal},
+	}
+	mccCache.Unlock()
+	defer InvalidateMccCategories()
+
+	cases := map[string]string{
+		"5411": WalletFood,
+		"5412": WalletFood,
+		"5811": WalletMeal,
+		"5812": WalletMeal,
+		"4121": WalletMeal, // a faixa mais estreita prevalece
+		"4122": WalletFood,
+		"5999": WalletCash,
+		"":     WalletCash,
+		"541":  WalletCash,
+	}
+
+	for mcc, expected := range cases {
+		got, err := ResolveMccCategory(nil, mcc)
+		if err != nil {
+			t.Fatalf("ResolveMccCategory(%q): unexpected error %v", mcc, err)
+		}
+		if got != expected {
+			t.Errorf("ResolveMccCategory(%q): expected %q. Got %q", mcc, expected, got)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// situações de um estabelecimento
+const (
+	MerchantActive   = "active"
+	MerchantInactive = "inactive"
+)
+
+// quantidade máxima de estabelecimentos retornados na busca
+const merchantsLimit = 50
+
+// erros do cadastro de estabelecimentos
+var (
+	ErrMerchantNotFound  = errors.New("Estabelecimento não encontrado")
+	ErrMerchantDuplicate = errors.New("Estabelecimento já cadastrado com esse nome")
+)
+
+// Merchant estabelecimento onde as transações acontecem
+//
+// O estabelecimento é criado automaticamente na primeira transação com o seu
+// nome e pode ser completado (CNPJ, cidade, situação) pelas rotas de
+// /merchants. O nome normalizado é único e é por ele que as transações são
+// associadas ao estabelecimento.
+type Merchant struct {
+	ID         int       `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name" gorm:"not null" validate:"required"`
+	Normalized string    `json:"normalized" gorm:"not null;uniqueIndex"` // NOME SEM ACENTOS E PONTUAÇÃO, EM MAIÚSCULAS
+	CNPJ       string    `json:"cnpj" gorm:"index" validate:"omitempty,len=14,numeric"`
+	Mcc        string    `json:"mcc" validate:"omitempty,len=4,numeric"`
+	City       string    `json:"city"`
+	Status     string    `json:"status" gorm:"not null;default:active" validate:"omitempty,oneof=active inactive"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// MerchantSummary estabelecimento com a quantidade e o volume das compras aprovadas
+type MerchantSummary struct {
+	Merchant
+	Transactions int64       `json:"transactions"`
+	Volume       money.Money `json:"volume"`
+}
+
+// SearchMerchants retorna os estabelecimentos cujo nome se parece com q,
+// do mais parecido para o menos parecido, ou todos em ordem de nome se q
+// estiver vazio
+//
+// A busca usa a similaridade de trigramas (pg_trgm) sobre o nome normalizado,
+// o que encontra também nomes com erros de digitação, e trechos do nome. A
+// quantidade e o volume somam as compras e capturas aprovadas apenas dos
+// estabelecimentos retornados, pelo índice de transactions por merchant_id.
+func SearchMerchants(app *app.App, q string) ([]MerchantSummary, error) {
+
+	matched := app.DB.Client.Table("merchants m").Limit(merchantsLimit)
+	order := clause.OrderBy{Expression: clause.Expr{SQL: "m.normalized"}}
+	if q = NormalizeMerchant(q); q != "" {
+		matched = matched.Where("m.normalized % ? OR m.normalized LIKE ?", q, "%"+q+"%")
+		order.Expression = clause.Expr{SQL: "similarity(m.normalized, ?) DESC, m.normalized", Vars: []interface{}{q}}
+	}
+
+	query := app.DB.Client.Table("(?) m", matched.Clauses(order)).
+		Select("m.*, COALESCE(s.transactions, 0) AS transactions, COALESCE(s.volume, 0) AS volume").
+		Joins(`LEFT JOIN LATERAL (SELECT COUNT(*) AS transactions, SUM(amount) AS volume
+			FROM transactions
+			WHERE merchant_id = m.id AND code = ? AND type IN ? AND deleted_at IS NULL) s ON true`,
+			CodeApproved, []string{TypePurchase, TypeCapture}).
+		Clauses(order)
+
+	merchants := []MerchantSummary{}
+	if result := query.Scan(&merchants); result.Error != nil {
+		return nil, errors.New("Erro na listagem dos estabelecimentos")
+	}
+
+	return merchants, nil
+}
+
+// FindMerchant procura o estabelecimento pelo id
+func FindMerchant(app *app.App, id int) (*Merchant, error) {
+
+	m := &Merchant{}
+	if result := app.DB.Client.Limit(1).Find(m, id); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o estabelecimento")
+	} else if result.RowsAffected == 0 {
+		return nil, ErrMerchantNotFound
+	}
+
+	return m, nil
+}
+
+// CreateMerchant cadastra um estabelecimento
+func (m *Merchant) CreateMerchant(app *app.App) (*Merchant, error) {
+
+	merchant := &Merchant{
+		Name:       m.Name,
+		Normalized: NormalizeMerchant(m.Name),
+		CNPJ:       m.CNPJ,
+		Mcc:        m.Mcc,
+		City:       m.City,
+		Status:     m.Status,
+	}
+	if merchant.Status == "" {
+		merchant.Status = MerchantActive
+	}
+
+	result := app.DB.Client.Clauses(clause.OnConflict{DoNothing: true}).Create(merchant)
+	if result.Error != nil {
+		return nil, errors.New("Erro ao cadastrar o estabelecimento")
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMerchantDuplicate
+	}
+
+	// transações anteriores ao cadastro com o mesmo nome passam a apontar para ele
+	if err := linkMerchantTransactions(app.DB.Client, merchant); err != nil {
+		return nil, err
+	}
+
+	return merchant, nil
+}
+
+// UpdateMerchant atualiza o cadastro do estabelecimento
+func (m *Merchant) UpdateMerchant(app *app.App, id int) (*Merchant, error) {
+
+	merchant, err := FindMerchant(app, id)
+	if err != nil {
+		return nil, err
+	}
+
+	merchant.Name = m.Name
+	merchant.Normalized = NormalizeMerchant(m.Name)
+	merchant.CNPJ = m.CNPJ
+	merchant.Mcc = m.Mcc
+	merchant.City = m.City
+	if m.Status != "" {
+		merchant.Status = m.Status
+	}
+
+	var count int64
+	if result := app.DB.Client.Model(&Merchant{}).
+		Where("normalized = ? AND id <> ?", merchant.Normalized, id).
+		Count(&count); result.Error != nil {
+		return nil, errors.New("Erro ao atualizar o estabelecimento")
+	} else if count > 0 {
+		return nil, ErrMerchantDuplicate
+	}
+
+	if result := app.DB.Client.Save(merchant); result.Error != nil {
+		return nil, errors.New("Erro ao atualizar o estabelecimento")
+	}
+
+	return merchant, nil
+}
+
+// DeleteMerchant remove o estabelecimento e desfaz a associação das
+// transações; uma nova transação com o mesmo nome volta a cadastrá-lo
+func DeleteMerchant(app *app.App, id int) error {
+
+	return app.DB.Client.Transaction(func(tx *gorm.DB) error {
+
+		if result := tx.Model(&Transaction{}).Where("merchant_id = ?", id).Update("merchant_id", nil); result.Error != nil {
+			return errors.New("Erro ao remover o estabelecimento")
+		}
+
+		result := tx.Delete(&Merchant{}, id)
+		if result.Error != nil {
+			return errors.New("Erro ao remover o estabelecimento")
+		}
+		if result.RowsAffected == 0 {
+			return ErrMerchantNotFound
+		}
+
+		return nil
+	})
+}
+
+// resolveMerchant associa a transação ao estabelecimento pelo nome
+// normalizado, cadastrando o estabelecimento na primeira transação
+func (t *Transaction) resolveMerchant(tx *gorm.DB) error {
+
+	normalized := NormalizeMerchant(t.Merchant)
+	if normalized == "" {
+		return nil
+	}
+
+	merchant := &Merchant{
+		Name:       t.Merchant,
+		Normalized: normalized,
+		Mcc:        t.Effective_mcc,
+		Status:     MerchantActive,
+	}
+	if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(merchant); result.Error != nil {
+		return errors.New("Erro ao cadastrar o estabelecimento da transação")
+	} else if result.RowsAffected == 0 {
+		if result := tx.Select("id").Where("normalized = ?", normalized).First(merchant); result.Error != nil {
+			return errors.New("Erro ao consultar o estabelecimento da transação")
+		}
+	}
+
+	t.Merchant_id = &merchant.ID
+	return nil
+}
+
+// linkMerchantTransactions associa ao estabelecimento as transações sem
+// estabelecimento com o mesmo nome normalizado
+func linkMerchantTransactions(db *gorm.DB, m *Merchant) error {
+
+	var names []string
+	if result := db.Model(&Transaction{}).
+		Where("merchant_id IS NULL AND merchant <> ''").
+		Distinct().
+		Pluck("merchant", &names); result.Error != nil {
+		return errors.New("Erro ao consultar as transações do estabelecimento")
+	}
+
+	var matching []string
+	for _, name := range names {
+		if NormalizeMerchant(name) == m.Normalized {
+			matching = append(matching, name)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+
+	if result := db.Model(&Transaction{}).
+		Where("merchant_id IS NULL AND merchant IN ?", matching).
+		Update("merchant_id", m.ID); result.Error != nil {
+		return errors.New("Erro ao associar as transações do estabelecimento")
+	}
+
+	return nil
+}
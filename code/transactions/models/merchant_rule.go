@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"cajueiro/pkg/app"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// MerchantRule modelo do registro de estabelecimentos que corrige o mcc enviado pelo adquirente
+type MerchantRule struct {
+	ID        int            `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"index" validate:"required_without=Pattern"` // NOME NORMALIZADO DO ESTABELECIMENTO
+	Pattern   string         `json:"pattern" validate:"required_without=Name"`              // EXPRESSÃO REGULAR SOBRE O NOME NORMALIZADO
+	Mcc       string         `json:"mcc" validate:"required_without=Wallet,omitempty,len=4,numeric"`
+	Wallet    string         `json:"wallet" validate:"required_without=Mcc,omitempty,category"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// ErrMerchantRuleNotFound regra inexistente no registro de estabelecimentos
+var ErrMerchantRuleNotFound = errors.New("Regra do estabelecimento não encontrada")
+
+// patternRule regra por padrão com a expressão regular já compilada
+type patternRule struct {
+	rule MerchantRule
+	re   *regexp.Regexp
+}
+
+// merchantRuleCache cache em memória das regras por padrão, compiladas
+var merchantRuleCache struct {
+	sync.RWMutex
+	loaded bool
+	rules  []patternRule
+}
+
+// InvalidateMerchantRules descarta o cache para que a próxima autorização releia a tabela
+func InvalidateMerchantRules() {
+	merchantRuleCache.Lock()
+	merchantRuleCache.loaded = false
+	merchantRuleCache.rules = nil
+	merchantRuleCache.Unlock()
+}
+
+// cachedPatternRules retorna as regras por padrão do cache, carregando e
+// compilando do banco se necessário
+func cachedPatternRules(db *gorm.DB) ([]patternRule, error) {
+
+	merchantRuleCache.RLock()
+	if merchantRuleCache.loaded {
+		rules := merchantRuleCache.rules
+		merchantRuleCache.RUnlock()
+		return rules, nil
+	}
+	merchantRuleCache.RUnlock()
+
+	merchantRuleCache.Lock()
+	defer merchantRuleCache.Unlock()
+
+	if !merchantRuleCache.loaded {
+		var rules []MerchantRule
+		if result := db.Where("pattern <> ''").Order("id").Find(&rules); result.Error != nil {
+			return nil, errors.New("Erro ao consultar o registro de estabelecimentos")
+		}
+
+		compiled := make([]patternRule, 0, len(rules))
+		for _, r := range rules {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				continue
+			}
+			compiled = append(compiled, patternRule{rule: r, re: re})
+		}
+		merchantRuleCache.rules = compiled
+		merchantRuleCache.loaded = true
+	}
+
+	return merchantRuleCache.rules, nil
+}
+
+// NormalizeMerchant normaliza o nome do estabelecimento removendo acentos,
+// pontuação e espaços repetidos
+func NormalizeMerchant(name string) string {
+
+	// remove os acentos do nome
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	name, _, _ = transform.String(t, name)
+
+	// troca pontuação por espaço e converte para maiúsculas
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return ' '
+	}, name)
+
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Validate verifica se a regra é consistente antes de salvar
+func (m *MerchantRule) Validate() error {
+
+	m.Name = NormalizeMerchant(m.Name)
+
+	if m.Pattern != "" {
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return errors.New("Padrão do estabelecimento inválido")
+		}
+	}
+
+	return nil
+}
+
+// CreateMerchantRule cria uma regra no registro de estabelecimentos e invalida o cache
+func (m *MerchantRule) CreateMerchantRule(app *app.App) (*MerchantRule, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	rule := &MerchantRule{
+		Name:    m.Name,
+		Pattern: m.Pattern,
+		Mcc:     m.Mcc,
+		Wallet:  m.Wallet,
+	}
+
+	if result := app.DB.Client.Create(rule); result.Error != nil {
+		return nil, errors.New("Erro ao criar a regra do estabelecimento")
+	}
+
+	InvalidateMerchantRules()
+
+	return rule, nil
+}
+
+// UpdateMerchantRule atualiza uma regra do registro de estabelecimentos e invalida o cache
+func (m *MerchantRule) UpdateMerchantRule(app *app.App, id int) (*MerchantRule, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	rule := &MerchantRule{}
+	if result := app.DB.Client.First(&rule, id); result.Error != nil {
+		return nil, ErrMerchantRuleNotFound
+	}
+
+	rule.Name = m.Name
+	rule.Pattern = m.Pattern
+	rule.Mcc = m.Mcc
+	rule.Wallet = m.Wallet
+
+	if result := app.DB.Client.Save(rule); result.Error != nil {
+		return nil, errors.New("Erro ao atualizar a regra do estabelecimento")
+	}
+
+	InvalidateMerchantRules()
+
+	return rule, nil
+}
+
+// DeleteMerchantRule remove uma regra do registro de estabelecimentos e invalida o cache
+func DeleteMerchantRule(app *app.App, id int) error {
+
+	result := app.DB.Client.Delete(&MerchantRule{}, id)
+	if result.Error != nil {
+		return errors.New("Erro ao remover a regra do estabelecimento")
+	}
+	if result.RowsAffected == 0 {
+		return ErrMerchantRuleNotFound
+	}
+
+	InvalidateMerchantRules()
+
+	return nil
+}
+
+// FindMerchantRule procura a regra aplicável ao estabelecimento, primeiro pelo
+// nome normalizado e depois pelos padrões em ordem de cadastro; os padrões
+// ficam compilados em memória até a próxima alteração do registro
+func FindMerchantRule(db *gorm.DB, merchant string) (*MerchantRule, error) {
+
+	name := NormalizeMerchant(merchant)
+	if name == "" {
+		return nil, nil
+	}
+
+	// procura pelo nome exato
+	var rules []MerchantRule
+	if result := db.Where("name = ?", name).Limit(1).Find(&rules); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o registro de estabelecimentos")
+	}
+	if len(rules) > 0 {
+		return &rules[0], nil
+	}
+
+	// procura pelos padrões cadastrados, já compilados no cache
+	patterns, err := cachedPatternRules(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range patterns {
+		if patterns[i].re.MatchString(name) {
+			rule := patterns[i].rule
+			return &rule, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import "testing"
+
+func TestNormalizeMerchant(t *testing.T) {
+
+	cases := map[string]string{
+		"UBER EATS SAO PAULO BR":   "UBER EATS SAO PAULO BR",
+		"  uber*eats   são paulo ": "UBER EATS SAO PAULO",
+		"Padaria Pão-de-Açúcar":    "PADARIA PAO DE ACUCAR",
+		"":                         "",
+	}
+
+	for in, expected := range cases {
+		if got := NormalizeMerchant(in); got != expected {
+			t.Errorf("NormalizeMerchant(%q): expected %q. Got %q", in, expected, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns colunas monetárias que eram float e passaram a ser numeric(15,2)
+var moneyColumns = map[string][]string{
+	"transactions": {"amount"},
+}
+
+// legacyWalletColumns colunas fixas de saldo da conta substituídas pela tabela wallets
+var legacyWalletColumns = map[string]string{
+	WalletFood: "amount_food",
+	WalletMeal: "amount_meal",
+	WalletCash: "amount_cash",
+}
+
+// Migrate migra os schemas do DB
+func Migrate(db *gorm.DB) error {
+	if err := migrateMoneyColumns(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&Account{}, &Wallet{}, &Transaction{}, &Hold{}, &LedgerEntry{}, &MerchantRule{}, &MccCategory{}, &IdempotencyKey{},
+		&Employer{}, &CreditSchedule{}, &TopUp{}, &PayrollBatch{}, &PayrollLine{}, &CreditLot{}, &CreditLotUse{}, &SpendingLimit{},
+		&FraudRule{}, &TriggeredRule{}, &Card{}, &Merchant{}); err != nil {
+		return err
+	}
+	if err := migrateLegacyWallets(db); err != nil {
+		return err
+	}
+	if err := migrateLedger(db); err != nil {
+		return err
+	}
+	if err := migrateMerchants(db); err != nil {
+		return err
+	}
+	if err := migrateTransactionIndexes(db); err != nil {
+		return err
+	}
+	if err := migratePayrollIndexes(db); err != nil {
+		return err
+	}
+	return migrateResponseCodes(db)
+}
+
+// migrateLedger impede UPDATE e DELETE em ledger_entries e abre o livro-razão
+// das carteiras que ainda não têm lançamentos, lançando o saldo atual contra
+// a conta externa
+func migrateLedger(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'ledger_entries é somente de inserção';
+			END;
+			$$ LANGUAGE plpgsql`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`CREATE TRIGGER ledger_entries_append_only
+			BEFORE UPDATE OR DELETE ON ledger_entries
+			FOR EACH ROW EXECUTE PROCEDURE ledger_entries_append_only()`).Error; err != nil {
+			return err
+		}
+
+		// a contrapartida é gravada antes, enquanto a carteira ainda não tem lançamentos
+		opening := `INSERT INTO ledger_entries (account_id, wallet, amount, balance, description, created_at)
+			SELECT %s, w.category, %s, %s, 'Saldo de abertura', now() FROM wallets w
+			WHERE w.balance <> 0 AND NOT EXISTS (
+				SELECT 1 FROM ledger_entries l WHERE l.account_id = w.account_id AND l.wallet = w.category)`
+		if err := tx.Exec(fmt.Sprintf(opening, "0", "-w.balance", "0")).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf(opening, "w.account_id", "w.balance", "w.balance")).Error
+	})
+}
+
+// migrateMerchants cria o índice de trigramas usado na busca de
+// estabelecimentos e cadastra os estabelecimentos das transações que ainda
+// não estão associadas a um
+func migrateMerchants(db *gorm.DB) error {
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_merchants_normalized_trgm
+		ON merchants USING gin (normalized gin_trgm_ops)`).Error; err != nil {
+		return err
+	}
+
+	var names []string
+	if err := db.Model(&Transaction{}).
+		Where("merchant_id IS NULL AND merchant <> ''").
+		Distinct().
+		Pluck("merchant", &names).Error; err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		t := &Transaction{Merchant: name}
+		if err := t.resolveMerchant(db); err != nil {
+			return err
+		}
+		if t.Merchant_id == nil {
+			continue
+		}
+		if err := db.Model(&Transaction{}).
+			Where("merchant_id IS NULL AND merchant = ?", name).
+			Update("merchant_id", *t.Merchant_id).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateTransactionIndexes cria os índices da listagem de transações da
+// conta, um para cada coluna de ordenação, com o id que desempata o cursor,
+// e o índice por estabelecimento usado nos totais da busca de estabelecimentos
+func migrateTransactionIndexes(db *gorm.DB) error {
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_transactions_account_created
+		ON transactions (account_id, created_at, id) WHERE deleted_at IS NULL`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_transactions_merchant
+		ON transactions (merchant_id) WHERE deleted_at IS NULL`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE INDEX IF NOT EXISTS idx_transactions_account_amount
+		ON transactions (account_id, amount, id) WHERE deleted_at IS NULL`).Error
+}
+
+// migratePayrollIndexes troca o índice comum de lotes por empregador e
+// checksum pelo índice único que impede importar o mesmo arquivo duas vezes;
+// lotes rejeitados não creditam e ficam fora do índice
+func migratePayrollIndexes(db *gorm.DB) error {
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_payroll_batches_checksum`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_payroll_batches_file
+		ON payroll_batches (employer_id, checksum) WHERE status <> 'rejected'`).Error
+}
+
+// migrateResponseCodes troca os antigos códigos "200" e "500" das transações
+// pelos códigos de resposta ISO 8583
+func migrateResponseCodes(db *gorm.DB) error {
+	if err := db.Model(&Transaction{}).Where("code = ?", "200").
+		Updates(map[string]interface{}{"code": CodeApproved, "reason": ""}).Error; err != nil {
+		return err
+	}
+	return db.Model(&Transaction{}).Where("code = ?", "500").
+		Updates(map[string]interface{}{"code": CodeInsufficientFunds, "reason": ReasonInsufficientFunds}).Error
+}
+
+// migrateLegacyWallets copia os saldos das antigas colunas amount_food,
+// amount_meal e amount_cash de accounts para a tabela wallets e remove as colunas
+func migrateLegacyWallets(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for category, column := range legacyWalletColumns {
+			if !tx.Migrator().HasColumn(&Account{}, column) {
+				continue
+			}
+
+			insert := fmt.Sprintf(`INSERT INTO wallets (account_id, category, balance, created_at, updated_at)
+				SELECT id, ?, round(coalesce(%s, 0)::numeric, 2), now(), now() FROM accounts
+				ON CONFLICT (account_id, category) DO NOTHING`, column)
+			if err := tx.Exec(insert, category).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().DropColumn(&Account{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateMoneyColumns converte as colunas monetárias existentes para
+// numeric(15,2), arredondando os valores gravados em ponto flutuante
+func migrateMoneyColumns(db *gorm.DB) error {
+	for table, columns := range moneyColumns {
+		for _, column := range columns {
+			var (
+				dataType  string
+				precision sql.NullInt64
+				scale     sql.NullInt64
+			)
+
+			row := db.Raw(`SELECT data_type, numeric_precision, numeric_scale
+				FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+				table, column).Row()
+			if err := row.Scan(&dataType, &precision, &scale); err != nil {
+				// tabela ou coluna ainda não existe, o AutoMigrate cria
+				if err == sql.ErrNoRows {
+					continue
+				}
+				return err
+			}
+
+			if dataType == "numeric" && precision.Int64 == 15 && scale.Int64 == 2 {
+				continue
+			}
+
+			alter := fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE numeric(15,2) USING round(%s::numeric, 2)`,
+				table, column, column)
+			if err := db.Exec(alter).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+	"cajueiro/pkg/payroll"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// modos de crédito do lote
+const (
+	PayrollAtomic  = "atomic"   // TODAS AS LINHAS EM UMA ÚNICA TRANSAÇÃO
+	PayrollPerLine = "per_line" // CADA LINHA EM UMA TRANSAÇÃO PRÓPRIA
+)
+
+// situações do lote
+const (
+	PayrollPending   = "pending"   // VALIDADO, AGUARDANDO OS CRÉDITOS
+	PayrollCompleted = "completed" // TODAS AS LINHAS VÁLIDAS CREDITADAS
+	PayrollFailed    = "failed"    // CRÉDITO INTERROMPIDO, PODE SER RETOMADO
+	PayrollRejected  = "rejected"  // LINHAS INVÁLIDAS NO MODO ATÔMICO, NADA FOI CREDITADO
+)
+
+// situações de uma linha do lote
+const (
+	LinePending  = "pending"
+	LineCredited = "credited"
+	LineInvalid  = "invalid"
+	LineFailed   = "failed"
+)
+
+// erros dos lotes da folha de benefícios
+var (
+	ErrPayrollNotFound = errors.New("Lote não encontrado")
+	ErrPayrollMode     = errors.New("Modo inválido, use atomic ou per_line")
+	ErrPayrollRejected = errors.New("Lote rejeitado na validação")
+	ErrPayrollEmpty    = errors.New("Arquivo sem linhas de crédito")
+)
+
+// ErrPayrollDuplicate arquivo já importado para o empregador
+type ErrPayrollDuplicate struct {
+	Batch_id uuid.UUID
+}
+
+func (e *ErrPayrollDuplicate) Error() string {
+	return fmt.Sprintf("Arquivo já importado no lote %s", e.Batch_id)
+}
+
+// PayrollBatch lote de créditos importado de um arquivo da folha do empregador
+//
+// As linhas são validadas e gravadas antes de qualquer crédito, de forma que
+// um lote interrompido pode ser retomado creditando apenas as linhas que
+// ainda não foram creditadas.
+type PayrollBatch struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey"`
+	Employer_id int            `json:"employer_id" gorm:"not null"`
+	Format      string         `json:"format" gorm:"not null"`
+	Mode        string         `json:"mode" gorm:"not null"`
+	Checksum    string         `json:"checksum" gorm:"not null"` // SHA-256 DO ARQUIVO, ÚNICO POR EMPREGADOR FORA DOS LOTES REJEITADOS
+	Status      string         `json:"status" gorm:"not null"`
+	Total       money.Money    `json:"total" gorm:"not null"` // SOMA DAS LINHAS VÁLIDAS
+	Summary     map[string]int `json:"summary" gorm:"-"`      // QUANTIDADE DE LINHAS POR SITUAÇÃO
+	Lines       []PayrollLine  `json:"lines" gorm:"foreignKey:Batch_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// PayrollLine crédito de uma linha do arquivo
+type PayrollLine struct {
+	ID         uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey"` // IDENTIFICADOR DOS LANÇAMENTOS NO LIVRO-RAZÃO
+	Batch_id   uuid.UUID   `json:"-" gorm:"type:uuid;not null;index"`
+	Line       int         `json:"line"` // NÚMERO DA LINHA NO ARQUIVO
+	CPF        string      `json:"cpf"`
+	Wallet     string      `json:"wallet"`
+	Amount     money.Money `json:"amount" gorm:"not null"`
+	Account_id *int        `json:"account_id,omitempty"`
+	Expires_at *time.Time  `json:"expires_at,omitempty"` // VENCIMENTO DO CRÉDITO, NIL SEM VALIDADE
+	Status     string      `json:"status" gorm:"not null"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"-"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// CreatePayrollBatch valida o arquivo da folha e grava o lote com uma linha
+// por crédito, sem creditar; os créditos são lançados por ProcessPayrollBatch
+//
+// Cada linha é validada quanto ao formato, à categoria, à validade, a CPFs
+// repetidos na mesma categoria e à conta, que deve existir e estar vinculada ao
+// empregador. No modo atômico qualquer linha inválida rejeita o lote; no
+// modo por linha as linhas inválidas são ignoradas.
+func CreatePayrollBatch(app *app.App, employer *Employer, format, mode string, data []byte) (*PayrollBatch, error) {
+
+	if mode != PayrollAtomic && mode != PayrollPerLine {
+		return nil, ErrPayrollMode
+	}
+
+	records, err := payroll.Parse(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrPayrollEmpty
+	}
+
+	sum := sha256.Sum256(data)
+	batch := &PayrollBatch{
+		ID:          uuid.New(),
+		Employer_id: employer.ID,
+		Format:      format,
+		Mode:        mode,
+		Checksum:    hex.EncodeToString(sum[:]),
+		Status:      PayrollPending,
+	}
+
+	accounts, err := payrollAccounts(app.DB.Client, records)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := app.Cfg.GetLocation()
+	seen := map[string]int{}
+	for _, rec := range records {
+		line := PayrollLine{
+			ID:       uuid.New(),
+			Batch_id: batch.ID,
+			Line:     rec.Line,
+			CPF:      rec.CPF,
+			Wallet:   rec.Wallet,
+			Amount:   rec.Amount,
+			Status:   LinePending,
+			Error:    rec.Err,
+		}
+		if rec.Expires != nil {
+			expires := expiresAfter(rec.Expires.Year(), rec.Expires.Month(), rec.Expires.Day(), loc)
+			line.Expires_at = &expires
+		}
+
+		a, found := accounts[rec.CPF]
+		key := rec.CPF + "/" + rec.Wallet
+		switch {
+		case line.Error != "":
+		case !app.Cfg.IsWalletCategory(rec.Wallet):
+			line.Error = "Categoria de carteira inválida: " + rec.Wallet
+		case line.Expires_at != nil && !line.Expires_at.After(time.Now()):
+			line.Error = "Validade já vencida"
+		case seen[key] > 0:
+			line.Error = fmt.Sprintf("CPF e categoria repetidos na linha %d", seen[key])
+		case !found:
+			line.Error = "Conta não encontrada"
+		case a.Status == AccountClosed:
+			line.Error = "Conta encerrada"
+		case a.Employer_id == nil || *a.Employer_id != employer.ID:
+			line.Error = "Conta não vinculada ao empregador"
+		}
+		if seen[key] == 0 && rec.Err == "" {
+			seen[key] = rec.Line
+		}
+
+		if line.Error != "" {
+			line.Status = LineInvalid
+			if mode == PayrollAtomic {
+				batch.Status = PayrollRejected
+			}
+		} else {
+			line.Account_id = &a.ID
+			batch.Total += line.Amount
+		}
+
+		batch.Lines = append(batch.Lines, line)
+	}
+
+	// um lote rejeitado não entra no índice único, mas o arquivo já importado
+	// continua sendo informado como repetido
+	if batch.Status == PayrollRejected {
+		if err := payrollDuplicate(app.DB.Client, batch); err != nil {
+			return nil, err
+		}
+	}
+
+	// o mesmo arquivo não pode ser creditado duas vezes: o índice único por
+	// empregador e checksum recusa o segundo lote, mesmo em imports concorrentes
+	duplicate := false
+	err = app.DB.Client.Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit("Lines").Clauses(clause.OnConflict{DoNothing: true}).Create(batch)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			duplicate = true
+			return nil
+		}
+		return tx.CreateInBatches(batch.Lines, 500).Error
+	})
+	if err != nil {
+		return nil, errors.New("Erro ao gravar o lote")
+	}
+	if duplicate {
+		if err := payrollDuplicate(app.DB.Client, batch); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("Erro ao consultar os lotes do empregador")
+	}
+
+	batch.summarize()
+	return batch, nil
+}
+
+// payrollDuplicate retorna ErrPayrollDuplicate com o lote não rejeitado do
+// mesmo arquivo do empregador, se houver
+func payrollDuplicate(db *gorm.DB, batch *PayrollBatch) error {
+
+	var existing []PayrollBatch
+	if result := db.
+		Where("employer_id = ? AND checksum = ? AND status <> ?", batch.Employer_id, batch.Checksum, PayrollRejected).
+		Limit(1).
+		Find(&existing); result.Error != nil {
+		return errors.New("Erro ao consultar os lotes do empregador")
+	}
+	if len(existing) > 0 {
+		return &ErrPayrollDuplicate{Batch_id: existing[0].ID}
+	}
+
+	return nil
+}
+
+// payrollAccounts retorna as contas dos CPFs do arquivo
+func payrollAccounts(db *gorm.DB, records []payroll.Record) (map[string]Account, error) {
+
+	var cpfs []string
+	for _, rec := range records {
+		if rec.Err == "" {
+			cpfs = append(cpfs, rec.CPF)
+		}
+	}
+
+	accounts := map[string]Account{}
+	if len(cpfs) == 0 {
+		return accounts, nil
+	}
+
+	var found []Account
+	if result := db.Select("id", "cpf", "employer_id", "status").Where("cpf IN ?", cpfs).Find(&found); result.Error != nil {
+		return nil, errors.New("Erro ao consultar as contas do lote")
+	}
+	for _, a := range found {
+		accounts[a.CPF] = a
+	}
+
+	return accounts, nil
+}
+
+// FindPayrollBatch procura o lote com as suas linhas
+func FindPayrollBatch(app *app.App, id uuid.UUID) (*PayrollBatch, error) {
+
+	var batches []PayrollBatch
+	if result := app.DB.Client.
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("line") }).
+		Where("id = ?", id).
+		Limit(1).
+		Find(&batches); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o lote")
+	}
+	if len(batches) == 0 {
+		return nil, ErrPayrollNotFound
+	}
+
+	batches[0].summarize()
+	return &batches[0], nil
+}
+
+// ProcessPayrollBatch credita as linhas pendentes do lote e retorna a
+// situação final; chamado de novo retoma um lote interrompido
+//
+// Os créditos entram no livro-razão contra a conta externa, com o
+// identificador da linha, que só é creditada uma vez.
+func ProcessPayrollBatch(app *app.App, id uuid.UUID) (*PayrollBatch, error) {
+
+	batch, err := FindPayrollBatch(app, id)
+	if err != nil {
+		return nil, err
+	}
+	switch batch.Status {
+	case PayrollRejected:
+		return batch, ErrPayrollRejected
+	case PayrollCompleted:
+		return batch, nil
+	}
+
+	employer, err := FindEmployer(app, batch.Employer_id)
+	if err != nil {
+		return nil, err
+	}
+	description := "Crédito " + employer.Name
+
+	if batch.Mode == PayrollAtomic {
+		err = creditBatch(app.DB.Client, batch.ID, description)
+	} else {
+		err = creditLines(app.DB.Client, batch, description)
+	}
+	if err != nil {
+		app.DB.Client.Model(&PayrollBatch{}).Where("id = ? AND status <> ?", batch.ID, PayrollCompleted).
+			Update("status", PayrollFailed)
+		return nil, err
+	}
+
+	return FindPayrollBatch(app, id)
+}
+
+// creditBatch credita todas as linhas pendentes em uma única transação
+func creditBatch(db *gorm.DB, id uuid.UUID, description string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+
+		// trava o lote, que só pode ser creditado uma vez
+		batch := &PayrollBatch{}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(batch, "id = ?", id); result.Error != nil {
+			return errors.New("Erro ao consultar o lote")
+		}
+		if batch.Status == PayrollCompleted {
+			return nil
+		}
+
+		var lines []PayrollLine
+		if result := tx.Where("batch_id = ? AND status IN ?", id, []string{LinePending, LineFailed}).
+			Order("line").
+			Find(&lines); result.Error != nil {
+			return errors.New("Erro ao consultar as linhas do lote")
+		}
+
+		// trava as contas em ordem crescente de id
+		ids := []int{}
+		for _, l := range lines {
+			ids = append(ids, *l.Account_id)
+		}
+		sort.Ints(ids)
+
+		var found []Account
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Wallets").
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&found); result.Error != nil {
+			return errors.New("Erro ao consultar as contas do lote")
+		}
+		accounts := map[int]*Account{}
+		for i := range found {
+			accounts[found[i].ID] = &found[i]
+		}
+
+		for _, l := range lines {
+			a, ok := accounts[*l.Account_id]
+			if !ok {
+				return fmt.Errorf("Conta da linha %d não encontrada", l.Line)
+			}
+			if err := l.credit(tx, a, description); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(batch).Update("status", PayrollCompleted).Error
+	})
+}
+
+// creditLines credita cada linha pendente em uma transação própria; linhas
+// com falha ficam registradas e são tentadas de novo quando o lote é retomado
+func creditLines(db *gorm.DB, batch *PayrollBatch, description string) error {
+
+	failed := false
+	for _, l := range batch.Lines {
+		if l.Status != LinePending && l.Status != LineFailed {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+
+			// trava a linha, que só pode ser creditada uma vez
+			line := &PayrollLine{}
+			if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(line, "id = ?", l.ID); result.Error != nil {
+				return errors.New("Erro ao consultar a linha do lote")
+			}
+			if line.Status == LineCredited {
+				return nil
+			}
+
+			a := &Account{}
+			if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Wallets").First(a, *line.Account_id); result.Error != nil {
+				return errors.New("Conta não encontrada")
+			}
+
+			return line.credit(tx, a, description)
+		})
+		if err != nil {
+			failed = true
+			if result := db.Model(&PayrollLine{}).Where("id = ?", l.ID).
+				Updates(map[string]interface{}{"status": LineFailed, "error": err.Error()}); result.Error != nil {
+				return errors.New("Erro ao registrar a falha da linha do lote")
+			}
+		}
+	}
+
+	status := PayrollCompleted
+	if failed {
+		status = PayrollFailed
+	}
+	if result := db.Model(&PayrollBatch{}).Where("id = ?", batch.ID).Update("status", status); result.Error != nil {
+		return errors.New("Erro ao atualizar a situação do lote")
+	}
+
+	return nil
+}
+
+// credit lança o crédito da linha na conta travada e marca a linha como creditada
+//
+// A conta encerrada depois da importação do lote não recebe o crédito.
+func (l *PayrollLine) credit(tx *gorm.DB, a *Account, description string) error {
+
+	if a.Status == AccountClosed {
+		return fmt.Errorf("Conta da linha %d encerrada", l.Line)
+	}
+
+	if err := postEntries(tx, &l.ID, description,
+		posting{account: a, wallet: l.Wallet, amount: l.Amount},
+		posting{wallet: l.Wallet, amount: -l.Amount},
+	); err != nil {
+		return err
+	}
+
+	if l.Expires_at != nil {
+		if err := a.addLot(tx, l.Wallet, l.Amount, l.ID, *l.Expires_at); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(l).Updates(map[string]interface{}{"status": LineCredited, "error": ""}).Error
+}
+
+// summarize conta as linhas do lote por situação
+func (b *PayrollBatch) summarize() {
+	b.Summary = map[string]int{}
+	for _, l := range b.Lines {
+		b.Summary[l.Status]++
+	}
+}
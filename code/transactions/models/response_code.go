@@ -0,0 +1,129 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+)
+
+// códigos de resposta da autorização, seguindo o campo 39 da ISO 8583
+const (
+	CodeApproved          = "00" // APROVADA
+	CodeRejected          = "07" // RECUSADA POR OUTROS MOTIVOS
+	CodeInvalidAccount    = "14" // CONTA INVÁLIDA
+	CodeFormatError       = "30" // ERRO DE FORMATO DA MENSAGEM
+	CodeInsufficientFunds = "51" // SALDO INSUFICIENTE
+	CodeCardExpired       = "54" // CARTÃO VENCIDO
+	CodeNotPermitted      = "57" // TRANSAÇÃO NÃO PERMITIDA AO PORTADOR (CONTA BLOQUEADA)
+	CodeSuspectedFraud    = "59" // SUSPEITA DE FRAUDE
+	CodeLimitExceeded     = "61" // LIMITE DE GASTO DA CARTEIRA EXCEDIDO
+	CodeCardBlocked       = "62" // CARTÃO BLOQUEADO (RESTRITO)
+	CodeTimeout           = "91" // EMISSOR INDISPONÍVEL (ORÇAMENTO DE LATÊNCIA ESGOTADO)
+	CodeDuplicate         = "94" // TRANSMISSÃO DUPLICADA (MESMO RRN E STAN COM OUTRO CONTEÚDO)
+	CodeSystemError       = "96" // FALHA NO SISTEMA
+)
+
+// DeclineReason motivo da recusa legível por máquina
+type DeclineReason string
+
+// motivos de recusa da autorização
+const (
+	ReasonAccountBlocked     DeclineReason = "account_blocked"
+	ReasonAccountClosed      DeclineReason = "account_closed"
+	ReasonCardBlocked        DeclineReason = "card_blocked"
+	ReasonCardCanceled       DeclineReason = "card_canceled"
+	ReasonCardExpired        DeclineReason = "card_expired"
+	ReasonInsufficientFunds  DeclineReason = "insufficient_funds"
+	ReasonInvalidAccount     DeclineReason = "invalid_account"
+	ReasonInvalidCard        DeclineReason = "invalid_card"
+	ReasonInvalidDestination DeclineReason = "invalid_destination"
+	ReasonLimitExceeded      DeclineReason = "limit_exceeded"
+	ReasonSameAccount        DeclineReason = "same_account"
+	ReasonSuspectedFraud     DeclineReason = "suspected_fraud"
+	ReasonTimeout            DeclineReason = "timeout"
+)
+
+// HTTPStatus retorna o status HTTP da resposta de autorização
+//
+// A regra é: transação aprovada ("00") responde 201 Created; conta de origem
+// ou de destino inválida ou encerrada ou cartão inválido ("14") responde 422
+// Unprocessable Entity; tempo esgotado ("91") responde 504 Gateway Timeout,
+// mantendo a chave de idempotência com a recusa; as demais recusas
+// ("51", "54", "57", "59", "61", "62", "07", ...) respondem 402 Payment
+// Required. Em todos os casos a recusa fica registrada e o corpo é um
+// AuthorizationResponse.
+func HTTPStatus(code string) int {
+	switch code {
+	case CodeApproved:
+		return http.StatusCreated
+	case CodeInvalidAccount:
+		return http.StatusUnprocessableEntity
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusPaymentRequired
+	}
+}
+
+// AuthorizationResponse corpo JSON da resposta de uma autorização
+type AuthorizationResponse struct {
+	Transaction_id uuid.UUID     `json:"transaction_id"`
+	Type           string        `json:"type"`
+	Parent_id      *uuid.UUID    `json:"parent_id,omitempty"`
+	Approved       bool          `json:"approved"`
+	Code           string        `json:"code"`
+	Reason         DeclineReason `json:"reason,omitempty"`
+	Message        string        `json:"message"`
+	Amount         money.Money   `json:"amount"`
+	Wallet         string        `json:"wallet,omitempty"`
+	Mcc            string        `json:"mcc"`
+	Effective_mcc  string        `json:"effective_mcc"`
+	Merchant       string        `json:"merchant"`
+	External_id    string        `json:"external_id,omitempty"`
+	Flagged        bool          `json:"flagged,omitempty"`
+	Created        time.Time     `json:"created"`
+}
+
+// Approved indica se a transação foi aprovada
+func (t *Transaction) Approved() bool {
+	return t.Code == CodeApproved
+}
+
+// Authorization monta a resposta de autorização da transação
+func (t *Transaction) Authorization() *AuthorizationResponse {
+	return &AuthorizationResponse{
+		Transaction_id: t.ID,
+		Type:           t.Type,
+		Parent_id:      t.Parent_id,
+		Approved:       t.Approved(),
+		Code:           t.Code,
+		Reason:         t.Reason,
+		Message:        t.Message,
+		Amount:         t.Amount,
+		Wallet:         t.Wallet,
+		Mcc:            t.Mcc,
+		Effective_mcc:  t.Effective_mcc,
+		Merchant:       t.Merchant,
+		External_id:    t.External_id,
+		Flagged:        t.Flagged,
+		Created:        t.CreatedAt,
+	}
+}
+
+// approve marca a transação como aprovada na carteira informada
+func (t *Transaction) approve(wallet, message string) {
+	t.Wallet = wallet
+	t.Code = CodeApproved
+	t.Reason = ""
+	t.Message = message
+}
+
+// decline marca a transação como recusada com o código e o motivo informados
+func (t *Transaction) decline(code string, reason DeclineReason, message string) {
+	t.Code = code
+	t.Reason = reason
+	t.Message = message
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TypeReversal estorno total ou parcial de uma compra ou captura
+const TypeReversal = "reversal"
+
+// erros do estorno
+var (
+	ErrReversalNotFound = errors.New("Transação não encontrada para estorno")
+	ErrReversalAmount   = errors.New("Valor do estorno deve ser positivo e até o valor ainda não estornado")
+	ErrReversalBalance  = errors.New("Saldo do estabelecimento insuficiente para o estorno")
+)
+
+// ReverseTransaction estorna a transação id no valor informado; valor zero
+// estorna todo o saldo ainda não estornado
+//
+// Só compras e capturas aprovadas podem ser estornadas. O valor volta para a
+// mesma carteira debitada na transação original e o lançamento no destino é
+// desfeito. A soma dos estornos nunca passa do valor original: a transação
+// original fica travada enquanto o total já estornado é conferido. A conta
+// informada deve ser a de destino da transação, que precisa ter o valor
+// disponível na carteira creditada; zero indica o operador.
+func ReverseTransaction(ctx context.Context, app *app.App, id uuid.UUID, accountID int, amount money.Money) (*Transaction, error) {
+
+	db := app.DB.Client.WithContext(ctx)
+
+	// procura a transação original aprovada
+	parent := &Transaction{}
+	if result := db.Where("id = ? AND type IN ?", id, []string{TypePurchase, TypeCapture}).Limit(1).Find(parent); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a transação")
+	} else if result.RowsAffected == 0 || !parent.Approved() {
+		return nil, ErrReversalNotFound
+	}
+	// só o estabelecimento creditado ou o operador estornam
+	if accountID != 0 && parent.Accounttocredit_id != accountID {
+		return nil, ErrReversalNotFound
+	}
+	if amount < 0 {
+		return nil, ErrReversalAmount
+	}
+
+	t := &Transaction{
+		ID:                 uuid.New(),
+		Type:               TypeReversal,
+		Parent_id:          &parent.ID,
+		Account_id:         parent.Account_id,
+		Accounttocredit_id: parent.Accounttocredit_id,
+		Amount:             amount,
+		Merchant:           parent.Merchant,
+		Merchant_id:        parent.Merchant_id,
+		Mcc:                parent.Mcc,
+		Effective_mcc:      parent.Effective_mcc,
+	}
+
+	// inicia o modo de transaction
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, errors.New("Erro na criação do estorno")
+	}
+
+	if err := t.reverse(tx, parent); err != nil {
+
+		// caso ocorra erro faz rollback
+		tx.Rollback()
+		return nil, err
+	}
+
+	// transação sem erros é comitada
+	if err := tx.Commit(); err.Error != nil {
+		return nil, errors.New("Erro na criação do estorno")
+	}
+
+	return t, nil
+}
+
+// reverse trava as contas e a transação original, confere o saldo a estornar
+// e registra o estorno
+func (t *Transaction) reverse(tx *gorm.DB, parent *Transaction) error {
+
+	// trava as contas de origem e destino
+	origem, destino, err := t.lockAccounts(tx)
+	if err != nil {
+		return err
+	}
+	if origem == nil || destino == nil {
+		return errors.New("Conta da transação não encontrada")
+	}
+
+	// trava a transação original para serializar estornos concorrentes
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Transaction{}, "id = ?", parent.ID); result.Error != nil {
+		return errors.New("Erro ao consultar a transação")
+	}
+
+	var reversed money.Money
+	if err := tx.Model(&Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("parent_id = ? AND type = ? AND code = ?", parent.ID, TypeReversal, CodeApproved).
+		Row().Scan(&reversed); err != nil {
+		return errors.New("Erro ao consultar os estornos da transação")
+	}
+
+	remaining := parent.Amount - reversed
+	if t.Amount == 0 {
+		t.Amount = remaining
+	}
+	if t.Amount <= 0 || t.Amount > remaining {
+		return ErrReversalAmount
+	}
+
+	// o estabelecimento devolve o valor com o saldo disponível da carteira creditada
+	if destino.available(parent.Wallet) < t.Amount {
+		return ErrReversalBalance
+	}
+
+	t.approve(parent.Wallet, "Estorno autorizado")
+
+	// devolve o valor à carteira debitada, estornando o crédito do destino
+	if err := t.transfer(tx, destino, origem, "Estorno "+t.Merchant); err != nil {
+		return err
+	}
+
+	// e aos créditos com validade que a transação original consumiu
+	if err := origem.restoreLots(tx, t.Wallet, t.Amount, parent.ID); err != nil {
+		return err
+	}
+
+	if result := tx.Create(t); result.Error != nil {
+		return errors.New("Erro na criação do estorno")
+	}
+
+	// vincula o estorno à chave de idempotência do request
+	return linkIdempotency(tx, t.ID)
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// erros dos limites de gasto
+var (
+	ErrLimitNotFound = errors.New("Limite não encontrado")
+)
+
+// SpendingLimit limites de gasto de uma carteira da conta
+//
+// Valor zero significa sem limite. As janelas diária e mensal começam à
+// meia-noite do fuso horário configurado (America/Sao_Paulo por padrão) e
+// somam as compras e as pré-autorizações aprovadas na carteira; pré-autorizações
+// canceladas ou expiradas deixam de contar e as capturadas contam pelo valor
+// capturado. Os estornos descontam o valor estornado na janela da original.
+type SpendingLimit struct {
+	ID              int         `json:"-" gorm:"primaryKey"`
+	Account_id      int         `json:"account_id" gorm:"not null;uniqueIndex:idx_spending_limits_account_wallet"`
+	Wallet          string      `json:"wallet" gorm:"not null;uniqueIndex:idx_spending_limits_account_wallet" validate:"required,category"`
+	Per_transaction money.Money `json:"per_transaction" gorm:"not null;default:0" validate:"gte=0"` // VALOR MÁXIMO POR TRANSAÇÃO
+	Daily           money.Money `json:"daily" gorm:"not null;default:0" validate:"gte=0"`           // TOTAL MÁXIMO NO DIA
+	Monthly         money.Money `json:"monthly" gorm:"not null;default:0" validate:"gte=0"`         // TOTAL MÁXIMO NO MÊS
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// FindLimits retorna os limites de gasto das carteiras da conta
+func FindLimits(app *app.App, accountID int) ([]SpendingLimit, error) {
+
+	limits := []SpendingLimit{}
+	if result := app.DB.Client.Where("account_id = ?", accountID).Order("wallet").Find(&limits); result.Error != nil {
+		return nil, errors.New("Erro ao consultar os limites da conta")
+	}
+
+	return limits, nil
+}
+
+// SaveLimit cria ou substitui os limites da carteira da conta
+func (l *SpendingLimit) SaveLimit(app *app.App) (*SpendingLimit, error) {
+
+	limit := &SpendingLimit{
+		Account_id:      l.Account_id,
+		Wallet:          l.Wallet,
+		Per_transaction: l.Per_transaction,
+		Daily:           l.Daily,
+		Monthly:         l.Monthly,
+	}
+	if result := app.DB.Client.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account_id"}, {Name: "wallet"}},
+		DoUpdates: clause.AssignmentColumns([]string{"per_transaction", "daily", "monthly", "updated_at"}),
+	}).Create(limit); result.Error != nil {
+		return nil, errors.New("Erro ao gravar o limite da conta")
+	}
+
+	return limit, nil
+}
+
+// DeleteLimit remove os limites da carteira da conta
+func DeleteLimit(app *app.App, accountID int, wallet string) error {
+
+	result := app.DB.Client.Where("account_id = ? AND wallet = ?", accountID, wallet).Delete(&SpendingLimit{})
+	if result.Error != nil {
+		return errors.New("Erro ao remover o limite da conta")
+	}
+	if result.RowsAffected == 0 {
+		return ErrLimitNotFound
+	}
+
+	return nil
+}
+
+// exceededLimit retorna a descrição do limite da carteira que o valor
+// ultrapassa em now, ou "" se a carteira não tem limite ou ele é respeitado
+//
+// A conta deve estar travada pela transação do banco recebida em tx, para que
+// autorizações concorrentes vejam o gasto umas das outras.
+func (a *Account) exceededLimit(tx *gorm.DB, wallet string, amount money.Money, now time.Time, loc *time.Location) (string, error) {
+
+	var limits []SpendingLimit
+	if result := tx.Where("account_id = ? AND wallet = ?", a.ID, wallet).Limit(1).Find(&limits); result.Error != nil {
+		return "", errors.New("Erro ao consultar os limites da conta")
+	}
+	if len(limits) == 0 {
+		return "", nil
+	}
+	l := limits[0]
+
+	if l.Per_transaction > 0 && amount > l.Per_transaction {
+		return "Limite por transação excedido", nil
+	}
+	if l.Daily == 0 && l.Monthly == 0 {
+		return "", nil
+	}
+
+	local := now.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+
+	spent := struct {
+		Daily   money.Money
+		Monthly money.Money
+	}{}
+	// os estornos aprovados descontam o gasto na janela da compra ou da
+	// pré-autorização que o contou; o estorno é sempre posterior à original
+	if result := tx.Raw(`SELECT
+			COALESCE(SUM(CASE WHEN s.created_at >= ? THEN s.amount END), 0) AS daily,
+			COALESCE(SUM(s.amount), 0) AS monthly
+		FROM (SELECT t.created_at, CASE
+				WHEN t.type = ? THEN t.amount
+				WHEN h.status = ? THEN h.amount
+				WHEN h.status = ? THEN h.captured
+				ELSE 0 END AS amount
+			FROM transactions t
+			LEFT JOIN holds h ON h.transaction_id = t.id
+			WHERE t.account_id = ? AND t.wallet = ? AND t.code = ? AND t.type IN ?
+				AND t.created_at >= ? AND t.deleted_at IS NULL
+			UNION ALL
+			SELECT COALESCE(pa.created_at, p.created_at), -r.amount
+			FROM transactions r
+			JOIN transactions p ON p.id = r.parent_id
+			LEFT JOIN transactions pa ON p.type = ? AND pa.id = p.parent_id
+			WHERE r.account_id = ? AND r.wallet = ? AND r.code = ? AND r.type = ?
+				AND r.created_at >= ? AND r.deleted_at IS NULL) s
+		WHERE s.created_at >= ?`,
+		day, TypePurchase, HoldActive, HoldCaptured,
+		a.ID, wallet, CodeApproved, []string{TypePurchase, TypePreauth}, month,
+		TypeCapture, a.ID, wallet, CodeApproved, TypeReversal, month,
+		month,
+	).Scan(&spent); result.Error != nil {
+		return "", errors.New("Erro ao consultar o gasto da conta")
+	}
+
+	if l.Daily > 0 && spent.Daily+amount > l.Daily {
+		return "Limite diário excedido", nil
+	}
+	if l.Monthly > 0 && spent.Monthly+amount > l.Monthly {
+		return "Limite mensal excedido", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StatementLine lançamento do extrato com o saldo da carteira logo após ele
+type StatementLine struct {
+	Entry_id       int64       `json:"entry_id"`
+	Created        time.Time   `json:"created"`
+	Transaction_id *uuid.UUID  `json:"transaction_id,omitempty"`
+	Type           string      `json:"type,omitempty"`
+	Description    string      `json:"description"`
+	Merchant       string      `json:"merchant,omitempty"`
+	Wallet         string      `json:"wallet"`
+	Amount         money.Money `json:"amount"`
+	Balance        money.Money `json:"balance"`
+}
+
+// Statement extrato da conta no período [From, To]
+type Statement struct {
+	Account_id int                    `json:"account_id"`
+	From       time.Time              `json:"from"`
+	To         time.Time              `json:"to"`
+	Opening    map[string]money.Money `json:"opening"` // SALDO DE CADA CARTEIRA ANTES DO PERÍODO
+	Closing    map[string]money.Money `json:"closing"` // SALDO DE CADA CARTEIRA NO FIM DO PERÍODO
+	Lines      []StatementLine        `json:"lines"`
+}
+
+// BalancesAt retorna o saldo de cada categoria configurada no instante at,
+// reconstruído a partir do livro-razão e dos bloqueios de pré-autorização
+func (a *Account) BalancesAt(app *app.App, db *gorm.DB, at time.Time) (map[string]WalletBalance, error) {
+
+	ledger, err := ledgerBalances(app, db, a.ID, "created_at <= ?", at)
+	if err != nil {
+		return nil, err
+	}
+
+	// bloqueio ativo em at: criado até at e ainda não encerrado naquele instante
+	rows, err := db.Model(&Hold{}).
+		Select("wallet, COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND created_at <= ?", a.ID, at).
+		Where("status = ? OR updated_at > ?", HoldActive, at).
+		Group("wallet").
+		Rows()
+	if err != nil {
+		return nil, errors.New("Erro ao consultar os bloqueios da conta")
+	}
+	defer rows.Close()
+
+	held := map[string]money.Money{}
+	for rows.Next() {
+		var (
+			wallet string
+			amount money.Money
+		)
+		if err := rows.Scan(&wallet, &amount); err != nil {
+			return nil, errors.New("Erro ao consultar os bloqueios da conta")
+		}
+		held[wallet] = amount
+	}
+
+	balances := map[string]WalletBalance{}
+	for category, balance := range ledger {
+		balances[category] = WalletBalance{Balance: balance, Held: held[category], Available: balance - held[category]}
+	}
+
+	return balances, nil
+}
+
+// StatementBalances monta o extrato da conta entre from e to apenas com os
+// saldos de abertura e de fechamento; os lançamentos vêm de StatementLines,
+// com o saldo de cada carteira após cada lançamento
+func (a *Account) StatementBalances(app *app.App, db *gorm.DB, from, to time.Time) (*Statement, error) {
+
+	s := &Statement{Account_id: a.ID, From: from, To: to, Lines: []StatementLine{}}
+
+	var err error
+	if s.Opening, err = ledgerBalances(app, db, a.ID, "created_at < ?", from); err != nil {
+		return nil, err
+	}
+	if s.Closing, err = ledgerBalances(app, db, a.ID, "created_at <= ?", to); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// StatementLines percorre os lançamentos da conta entre from e to, em ordem
+// cronológica, sem carregar o período inteiro em memória
+func (a *Account) StatementLines(db *gorm.DB, from, to time.Time, fn func(StatementLine) error) error {
+
+	rows, err := db.Table("ledger_entries l").
+		Select("l.id, l.created_at, l.transaction_id, t.type, l.description, t.merchant, l.wallet, l.amount, l.balance").
+		Joins("LEFT JOIN transactions t ON t.id = l.transaction_id").
+		Where("l.account_id = ? AND l.created_at >= ? AND l.created_at <= ?", a.ID, from, to).
+		Order("l.id").
+		Rows()
+	if err != nil {
+		return errors.New("Erro ao consultar o extrato da conta")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			line     StatementLine
+			kind     *string
+			merchant *string
+		)
+		if err := rows.Scan(&line.Entry_id, &line.Created, &line.Transaction_id, &kind, &line.Description, &merchant,
+			&line.Wallet, &line.Amount, &line.Balance); err != nil {
+			return errors.New("Erro ao consultar o extrato da conta")
+		}
+		if kind != nil {
+			line.Type = *kind
+		}
+		if merchant != nil {
+			line.Merchant = *merchant
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ledgerBalances retorna o saldo de cada categoria configurada pelo último
+// lançamento de cada carteira que satisfaz a condição informada
+func ledgerBalances(app *app.App, db *gorm.DB, accountID int, condition string, at time.Time) (map[string]money.Money, error) {
+
+	balances := map[string]money.Money{}
+	for _, category := range app.Cfg.GetWalletCategories() {
+		balances[category] = 0
+	}
+
+	var entries []LedgerEntry
+	if result := db.Raw(`SELECT DISTINCT ON (wallet) wallet, balance FROM ledger_entries
+		WHERE account_id = ? AND `+condition+`
+		ORDER BY wallet, id DESC`, accountID, at).Scan(&entries); result.Error != nil {
+		return nil, errors.New("Erro ao consultar o saldo da conta")
+	}
+	for _, e := range entries {
+		balances[e.Wallet] = e.Balance
+	}
+
+	return balances, nil
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quantidade de contas creditadas por consulta no job de créditos agendados
+const topUpsBatch = 100
+
+// TopUp crédito agendado já lançado em uma conta
+//
+// O índice único por agendamento, conta e período garante que cada crédito
+// é lançado uma única vez por mês, mesmo que o job rode de novo após um
+// reinício ou em mais de uma instância.
+type TopUp struct {
+	ID          uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey"` // IDENTIFICADOR DOS LANÇAMENTOS NO LIVRO-RAZÃO
+	Schedule_id int         `json:"schedule_id" gorm:"not null;uniqueIndex:idx_top_ups_period"`
+	Account_id  int         `json:"account_id" gorm:"not null;uniqueIndex:idx_top_ups_period"`
+	Period      string      `json:"period" gorm:"not null;uniqueIndex:idx_top_ups_period"` // MÊS DE REFERÊNCIA, AAAA-MM
+	Wallet      string      `json:"wallet" gorm:"not null"`
+	Amount      money.Money `json:"amount" gorm:"not null"`
+	Expires_at  *time.Time  `json:"expires_at,omitempty"` // VENCIMENTO DO CRÉDITO, NIL SEM VALIDADE
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// RunTopUps lança os créditos agendados já devidos no mês de now que ainda
+// não foram lançados e retorna quantos foram lançados
+//
+// Os dias úteis seguem o fuso horário configurado. Contas vinculadas ao
+// empregador depois do dia do crédito recebem o crédito do mês corrente na
+// próxima execução. Um agendamento ou uma conta com erro é registrado no log e
+// não impede os demais; o índice único de TopUp permite repetir a execução.
+func RunTopUps(app *app.App, now time.Time) (int, error) {
+
+	local := now.In(app.Cfg.GetLocation())
+	period := local.Format("2006-01")
+
+	var employers []Employer
+	if result := app.DB.Client.Preload("Schedules").Order("id").Find(&employers); result.Error != nil {
+		return 0, errors.New("Erro ao consultar os créditos agendados")
+	}
+
+	credited, failed := 0, 0
+	for _, e := range employers {
+		for _, s := range e.Schedules {
+			if local.Before(s.due(local.Year(), local.Month(), local.Location())) {
+				continue
+			}
+
+			n, f, err := s.topUp(app, &e, period, s.expires(local))
+			credited += n
+			failed += f
+			if err != nil {
+				failed++
+				app.Log.Error(fmt.Sprintf("Erro no crédito agendado %d: %s", s.ID, err.Error()))
+			}
+		}
+	}
+
+	if failed > 0 {
+		return credited, fmt.Errorf("Erro em %d créditos agendados", failed)
+	}
+
+	return credited, nil
+}
+
+// topUp lança o crédito do período nas contas do empregador que ainda não o
+// receberam e retorna quantas foram creditadas e quantas falharam; contas
+// encerradas não recebem créditos
+func (s *CreditSchedule) topUp(app *app.App, e *Employer, period string, expires *time.Time) (int, int, error) {
+
+	credited, failed := 0, 0
+
+	// continua depois da última conta do lote anterior, de forma que uma
+	// conta com erro não volta no lote seguinte
+	last := 0
+	for {
+		var accounts []int
+		if result := app.DB.Client.Model(&Account{}).
+			Where("employer_id = ? AND status <> ? AND id > ?", e.ID, AccountClosed, last).
+			Where(`NOT EXISTS (SELECT 1 FROM top_ups u
+				WHERE u.schedule_id = ? AND u.account_id = accounts.id AND u.period = ?)`, s.ID, period).
+			Order("id").
+			Limit(topUpsBatch).
+			Pluck("id", &accounts); result.Error != nil {
+			return credited, failed, errors.New("Erro ao consultar as contas do empregador")
+		}
+
+		for _, id := range accounts {
+			ok, err := s.credit(app.DB.Client, id, period, "Crédito "+e.Name, expires)
+			if err != nil {
+				failed++
+				app.Log.Error(fmt.Sprintf("Erro no crédito agendado %d da conta %d: %s", s.ID, id, err.Error()))
+				continue
+			}
+			if ok {
+				credited++
+			}
+		}
+
+		if len(accounts) < topUpsBatch {
+			return credited, failed, nil
+		}
+		last = accounts[len(accounts)-1]
+	}
+}
+
+// credit lança o crédito do período na conta, com o vencimento informado;
+// retorna false se ele já foi lançado ou se a conta foi encerrada
+func (s *CreditSchedule) credit(db *gorm.DB, accountID int, period, description string, expires *time.Time) (bool, error) {
+
+	credited := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+
+		a := &Account{}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Wallets").First(a, accountID); result.Error != nil {
+			return errors.New("Erro ao consultar a conta do crédito agendado")
+		}
+		// conta encerrada depois da consulta das contas do empregador
+		if a.Status == AccountClosed {
+			return nil
+		}
+
+		topUp := &TopUp{
+			ID:          uuid.New(),
+			Schedule_id: s.ID,
+			Account_id:  accountID,
+			Period:      period,
+			Wallet:      s.Wallet,
+			Amount:      s.Amount,
+			Expires_at:  expires,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(topUp)
+		if result.Error != nil {
+			return errors.New("Erro ao registrar o crédito agendado")
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := postEntries(tx, &topUp.ID, description,
+			posting{account: a, wallet: s.Wallet, amount: s.Amount},
+			posting{wallet: s.Wallet, amount: -s.Amount},
+		); err != nil {
+			return err
+		}
+
+		if expires != nil {
+			if err := a.addLot(tx, s.Wallet, s.Amount, topUp.ID, *expires); err != nil {
+				return err
+			}
+		}
+
+		credited = true
+		return nil
+	})
+
+	return credited, err
+}
@@ -1,58 +1,141 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BeforeCreate hook do gorm para gerar uuid no create
 func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
-	t.ID = uuid.New()
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
 	return
 }
 
+// tipos de transação
+const (
+	TypePurchase = "purchase" // COMPRA COM DÉBITO IMEDIATO
+	TypePreauth  = "preauth"  // PRÉ-AUTORIZAÇÃO, APENAS BLOQUEIA O SALDO
+	TypeCapture  = "capture"  // CAPTURA DE UMA PRÉ-AUTORIZAÇÃO
+	TypeVoid     = "void"     // CANCELAMENTO DE UMA PRÉ-AUTORIZAÇÃO
+)
+
+// prazo para registrar a recusa por tempo, já fora do orçamento da autorização
+const timeoutRecordBudget = 5 * time.Second
+
 // Transaction modelo para transação do usuário
 type Transaction struct {
-	gorm.Model         `json:"-"`
-	ID                 uuid.UUID      `json:"id" gorm:"type:uuid"` // IDENTIFICADOR UNICO DA TRANSAÇÃO
-	Accounttocredit_id int            `json:"accounttocredit_id"`
-	Account_id         int            `json:"account_id"` // IDENTIFICADOR DA CONTA DA QUAL FOI DEBITADO
-	AccountID          int            // ID DE REFERÊNCIA NA TABELA DE CONTA
-	Amount             float64        `json:"amount" gorm:"type:numeric"`
-	Merchant           string         `json:"merchant"`
-	Mcc                string         `json:"mcc"`
-	Message            string         `json:"message"`
-	Code               string         `json:"code"`
-	CreatedAt          time.Time      `json:"created"`
-	UpdatedAt          time.Time      `json:"updated"`
-	DeletedAt          gorm.DeletedAt `gorm:"index" json:"deleted"`
+	ID                 uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey"` // IDENTIFICADOR UNICO DA TRANSAÇÃO
+	Accounttocredit_id int             `json:"accounttocredit_id"`
+	Account_id         int             `json:"account_id"`                                                                        // IDENTIFICADOR DA CONTA DA QUAL FOI DEBITADO
+	Card_token         string          `json:"card_token,omitempty" gorm:"-" validate:"omitempty,uuid"`                           // TOKEN DO CARTÃO USADO NA COMPRA
+	Card_id            *int            `json:"-" gorm:"index"`                                                                    // CARTÃO USADO NA COMPRA
+	Type               string          `json:"type" gorm:"not null;default:purchase" validate:"omitempty,oneof=purchase preauth"` // TIPO DA TRANSAÇÃO
+	Parent_id          *uuid.UUID      `json:"parent_id,omitempty" gorm:"type:uuid;index"`                                        // TRANSAÇÃO ORIGINAL
+	Amount             money.Money     `json:"amount" validate:"gt=0"`
+	Merchant           string          `json:"merchant"`
+	Merchant_id        *int            `json:"merchant_id,omitempty" gorm:"index"` // ESTABELECIMENTO CADASTRADO PELO NOME
+	Mcc                string          `json:"mcc"`                                // MCC ORIGINAL ENVIADO PELO ADQUIRENTE
+	Effective_mcc      string          `json:"effective_mcc"`                      // MCC EFETIVO APÓS O REGISTRO DE ESTABELECIMENTOS
+	Wallet             string          `json:"wallet"`                             // CARTEIRA DEBITADA (food, meal ou cash)
+	External_id        string          `json:"external_id" gorm:"index"`           // IDENTIFICADOR DA TRANSAÇÃO NO ADQUIRENTE
+	Message            string          `json:"message"`
+	Code               string          `json:"code"`                                  // CÓDIGO DE RESPOSTA ISO 8583 (CAMPO 39)
+	Reason             DeclineReason   `json:"reason"`                                // MOTIVO DA RECUSA
+	Flagged            bool            `json:"flagged" gorm:"not null;default:false"` // MARCADA PARA REVISÃO POR UMA REGRA ANTIFRAUDE
+	Rules              []TriggeredRule `json:"rules,omitempty" gorm:"-"`              // REGRAS ANTIFRAUDE DISPARADAS NA AUTORIZAÇÃO
+	CreatedAt          time.Time       `json:"created"`
+	UpdatedAt          time.Time       `json:"updated"`
+	DeletedAt          gorm.DeletedAt  `gorm:"index" json:"deleted"`
 }
 
 // CreateTransaction realiza uma transação entre contas
-func (t *Transaction) CreateTransaction(app *app.App) (*Transaction, error) {
+//
+// A verificação de saldo, o débito, o crédito e o registro da transação são
+// feitos em uma única transação do banco, com as contas travadas via
+// SELECT ... FOR UPDATE, de forma que autorizações concorrentes na mesma conta
+// são serializadas e o saldo nunca fica negativo.
+//
+// Todas as consultas respeitam o prazo do ctx. Se ele expirar antes do commit
+// a transação do banco é desfeita por inteiro e a autorização é recusada com
+// o código "91" (ReasonTimeout); a recusa é registrada em segundo plano para
+// não atrasar ainda mais a resposta. Se o prazo expirar durante ou depois do
+// COMMIT a gravação pode já ter sido aplicada: nesse caso a transação gravada
+// é retornada no lugar da recusa.
+func (t *Transaction) CreateTransaction(ctx context.Context, app *app.App) (*Transaction, error) {
+	start := time.Now()
+
+	// o id é gerado aqui para ser o mesmo na transação e na recusa por tempo
+	t.ID = uuid.New()
+	if t.Type == "" {
+		t.Type = TypePurchase
+	}
+
+	transaction, err := t.createTransaction(app, app.DB.Client.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		if committed := t.committed(app); committed != nil {
+			transaction, err = committed, nil
+		} else {
+			transaction, err = t.declineTimeout(app), nil
+		}
+	}
+
+	t.logLatency(app, transaction, err, time.Since(start))
+	return transaction, err
+
+}
+
+// createTransaction autoriza e registra a transação usando a sessão db,
+// que carrega o prazo da autorização
+//
+// Uma compra debita a origem e credita o destino; uma pré-autorização apenas
+// bloqueia o valor na carteira até a captura, o cancelamento ou a expiração.
+func (t *Transaction) createTransaction(app *app.App, db *gorm.DB) (*Transaction, error) {
+
+	// escolhe a carteira do mcc antes de travar as contas
+	wallet, err := t.resolveWallet(db)
+	if err != nil {
+		return nil, err
+	}
 
 	// inicia o modo de transaction
-	tx := app.DB.Client.Begin()
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, errors.New("Erro na criação da transação")
+	}
 
-	// verifica se a conta de destino existe
-	if err := t.checkDestinationAccount(app); err != nil {
+	// trava as contas de origem e destino
+	origem, destino, err := t.lockAccounts(tx)
+	if err != nil {
 
-		// caso não encontre faz rollback
+		// caso ocorra erro faz rollback
 		tx.Rollback()
 		return nil, err
 	}
 
-	// verifica se a conta de origem tem saldo suficiente
-	if err := t.checkOriginBalance(app); err != nil {
+	// aprova ou recusa a transação com as contas travadas
+	if err := t.authorize(tx, app.Cfg.GetLocation(), wallet, origem, destino); err != nil {
 
-		// caso não tenha saldo faz rollback
+		// caso ocorra erro faz rollback
 		tx.Rollback()
+		return nil, err
+	}
 
+	// associa a transação ao estabelecimento, cadastrando-o se for novo
+	if err := t.resolveMerchant(tx); err != nil {
+
+		// caso ocorra erro faz rollback
+		tx.Rollback()
 		return nil, err
 	}
 
@@ -61,12 +144,21 @@ func (t *Transaction) CreateTransaction(app *app.App) (*Transaction, error) {
 		ID:                 t.ID,
 		Accounttocredit_id: t.Accounttocredit_id,
 		Account_id:         t.Account_id,
-		AccountID:          t.AccountID,
+		Card_token:         t.Card_token,
+		Card_id:            t.Card_id,
+		Type:               t.Type,
 		Amount:             t.Amount,
 		Merchant:           t.Merchant,
+		Merchant_id:        t.Merchant_id,
 		Mcc:                t.Mcc,
+		Effective_mcc:      t.Effective_mcc,
+		Wallet:             t.Wallet,
+		External_id:        t.External_id,
 		Message:            t.Message,
 		Code:               t.Code,
+		Reason:             t.Reason,
+		Flagged:            t.Flagged,
+		Rules:              t.Rules,
 		CreatedAt:          t.CreatedAt,
 		UpdatedAt:          t.UpdatedAt,
 		DeletedAt:          t.DeletedAt,
@@ -78,252 +170,304 @@ func (t *Transaction) CreateTransaction(app *app.App) (*Transaction, error) {
 		return nil, errors.New("Erro na criação da transação")
 	}
 
-	switch t.Code {
-	case "500":
-		// transação sem erros é comitada
-		tx.Commit()
-	case "200":
+	// vincula a transação à chave de idempotência do request
+	if err := linkIdempotency(tx, transaction.ID); err != nil {
 
-		// atualiza o saldo da conta de origem
-		if err := t.balanceOriginAccount(app); err != nil {
+		// caso ocorra erro faz rollback
+		tx.Rollback()
+		return nil, err
+	}
+
+	// registra as regras antifraude disparadas, aprovada ou não
+	if len(t.Rules) > 0 {
+		if err := tx.Create(&t.Rules); err.Error != nil {
 
 			// caso ocorra erro faz rollback
 			tx.Rollback()
-			return nil, err
+			return nil, errors.New("Erro ao registrar as regras antifraude da transação")
 		}
+	}
 
-		// atualiza o saldo da conta de destino
-		if err := t.balanceDestinationAccount(app); err != nil {
+	if t.Approved() && t.Type == TypePreauth {
+
+		// bloqueia o valor na carteira da conta de origem
+		if err := t.placeHold(tx, origem, app.Cfg.GetHoldExpiry()); err != nil {
 
 			// caso ocorra erro faz rollback
 			tx.Rollback()
 			return nil, err
 		}
+	} else if t.Approved() {
 
-		// transação sem erros é comitada
-		tx.Commit()
+		// debita a origem e credita o destino no livro-razão
+		if err := t.transfer(tx, origem, destino, "Compra "+t.Merchant); err != nil {
 
-		// caso sucesso retorna erro nulo
-		return transaction, nil
+			// caso ocorra erro faz rollback
+			tx.Rollback()
+			return nil, err
+		}
+	}
 
+	// transação sem erros é comitada
+	if err := tx.Commit(); err.Error != nil {
+		return nil, errors.New("Erro na criação da transação")
 	}
+
+	// caso sucesso retorna erro nulo
 	return transaction, nil
 
 }
 
-// checkDestinationAccount verifica se a conta de destino existe
-func (t *Transaction) checkDestinationAccount(app *app.App) error {
+// committed procura, com um prazo próprio, a transação t que pode ter sido
+// gravada quando o prazo da autorização venceu durante o COMMIT; retorna nil
+// se ela não foi gravada ou se não foi possível confirmar
+func (t *Transaction) committed(app *app.App) *Transaction {
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutRecordBudget)
+	defer cancel()
 
-	if t.Accounttocredit_id == t.Account_id {
-		return errors.New("Contas de transação devem ser diferentes")
+	var transactions []Transaction
+	if result := app.DB.Client.WithContext(ctx).Where("id = ?", t.ID).Limit(1).Find(&transactions); result.Error != nil {
+		app.Log.Error("Erro ao verificar a transação após o prazo: " + result.Error.Error())
+		return nil
+	}
+	if len(transactions) == 0 {
+		return nil
 	}
 
-	// captura a conta de destino no banco
-	a := &Account{}
+	return &transactions[0]
+}
 
-	if result := app.DB.Client.First(&a, &t.Accounttocredit_id); result.Error != nil {
-		return errors.New("Conta de destino não encontrada")
-	}
+// declineTimeout recusa a autorização que excedeu o orçamento de latência
+//
+// A tentativa original não foi gravada, então a recusa é registrada com um
+// prazo próprio, em segundo plano, e a resposta segue imediatamente. Se a
+// tentativa tiver sido gravada sem que committed conseguisse confirmar, o
+// registro da recusa falha pelo id repetido e a chave de idempotência, que
+// não é liberada no código "91", impede um novo débito.
+func (t *Transaction) declineTimeout(app *app.App) *Transaction {
+
+	t.decline(CodeTimeout, ReasonTimeout, "Transação não autorizada - Tempo de resposta excedido")
+
+	// o que foi resolvido na tentativa desfeita não vale para a recusa
+	t.Merchant_id = nil
+	t.Card_id = nil
+	t.Flagged = false
+	t.Rules = nil
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+
+	transaction := *t
+	record := *t
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutRecordBudget)
+		defer cancel()
+
+		if result := app.DB.Client.WithContext(ctx).Create(&record); result.Error != nil {
+			app.Log.Error("Erro ao registrar recusa por tempo: " + result.Error.Error())
+		}
+	}()
 
-	// retorna exista conta de destino retorna erro nulo
-	return nil
+	return &transaction
 
 }
 
-// checkOriginBalance verifica se a conta de origem tem saldo suficiente
-func (t *Transaction) checkOriginBalance(app *app.App) error {
+// logLatency registra a duração da autorização e o resultado
+func (t *Transaction) logLatency(app *app.App, transaction *Transaction, err error, elapsed time.Duration) {
+
+	entry := app.Log.WithFields(logrus.Fields{
+		"transaction_id": t.ID,
+		"account_id":     t.Account_id,
+		"latency_ms":     float64(elapsed.Microseconds()) / 1000,
+	})
 
-	// captura a conta de origem no banco
-	a := &Account{}
-	if result := app.DB.Client.First(&a, &t.Account_id); result.Error != nil {
-		return errors.New("Conta de origem não encontrada")
+	if err != nil {
+		entry.WithError(err).Error("Erro na autorização")
+		return
 	}
 
-	/*
-		Se o `mcc` for `"5411" ou "5412"`, deve-se utilizar o saldo de `FOOD` - Amount_food
-		Se o `mcc` for `"5811" ou "5812"`, deve-se utilizar o saldo de `MEAL`.- Amount_meal
-		Para quaisquer outros valores do `mcc`, deve-se utilizar o saldo de `CASH` - Amount_cash
-	*/
+	entry.WithField("code", transaction.Code).Info("Autorização processada")
 
-	// caso não tenha saldo suficiente retorna erro adequado
-	switch t.Mcc {
+}
 
-	case "5411":
+// lockAccounts trava as contas de origem e destino com SELECT ... FOR UPDATE
+//
+// As contas são sempre travadas em ordem crescente de id para que duas
+// transações em sentidos opostos não entrem em deadlock. Conta não encontrada
+// é retornada como nil.
+func (t *Transaction) lockAccounts(tx *gorm.DB) (*Account, *Account, error) {
+
+	var accounts []Account
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Wallets").
+		Where("id IN ?", []int{t.Account_id, t.Accounttocredit_id}).
+		Order("id").
+		Find(&accounts); result.Error != nil {
+		return nil, nil, errors.New("Erro ao consultar as contas da transação")
+	}
 
-		if (a.Amount_food - t.Amount) < 0 {
-			t.Message = "Transação não autorizada - Saldo na conta insuficiente - food"
-			t.Code = "500"
-		} else {
-			t.Code = "200"
-			t.Message = "Transação autorizada"
+	var origem, destino *Account
+	for i := range accounts {
+		switch accounts[i].ID {
+		case t.Account_id:
+			origem = &accounts[i]
+		case t.Accounttocredit_id:
+			destino = &accounts[i]
 		}
+	}
 
-	case "5412":
-		if (a.Amount_food - t.Amount) < 0 {
-			t.Message = "Transação não autorizada - Saldo na conta insuficiente - food"
-			t.Code = "500"
-		} else {
-			t.Code = "200"
-			t.Message = "Transação autorizada"
+	return origem, destino, nil
+
+}
+
+// authorize aprova ou recusa a transação com as contas já travadas
+//
+// A transação é recusada se a conta de origem estiver bloqueada ou encerrada
+// ou se a conta de destino estiver encerrada. Com o token de um cartão a
+// transação é recusada se o cartão não for da conta de origem, estiver
+// bloqueado, cancelado ou vencido. Antes da
+// aprovação passam as regras antifraude: uma regra com a ação
+// decline recusa a transação com o código "59" e uma regra com a ação flag
+// marca a transação aprovada para revisão. Os limites de gasto da carteira
+// são verificados antes do saldo, nas janelas do fuso horário loc.
+func (t *Transaction) authorize(tx *gorm.DB, loc *time.Location, wallet string, origem, destino *Account) error {
+
+	switch {
+	case t.Accounttocredit_id == t.Account_id:
+		t.Wallet = wallet
+		t.decline(CodeRejected, ReasonSameAccount, "Transação não autorizada - Contas de transação devem ser diferentes")
+	case origem == nil:
+		t.Wallet = wallet
+		t.decline(CodeInvalidAccount, ReasonInvalidAccount, "Transação não autorizada - Conta de origem não encontrada")
+	case destino == nil:
+		t.Wallet = wallet
+		t.decline(CodeInvalidAccount, ReasonInvalidDestination, "Transação não autorizada - Conta de destino não encontrada")
+	case origem.Status == AccountClosed:
+		t.Wallet = wallet
+		t.decline(CodeInvalidAccount, ReasonAccountClosed, "Transação não autorizada - Conta de origem encerrada")
+	case origem.Status == AccountBlocked:
+		t.Wallet = wallet
+		t.decline(CodeNotPermitted, ReasonAccountBlocked, "Transação não autorizada - Conta de origem bloqueada")
+	case destino.Status == AccountClosed:
+		t.Wallet = wallet
+		t.decline(CodeInvalidAccount, ReasonInvalidDestination, "Transação não autorizada - Conta de destino encerrada")
+	case t.Card_token != "":
+		card, err := t.lockCard(tx)
+		if err != nil {
+			return err
 		}
-	case "5811":
-		if (a.Amount_meal - t.Amount) < 0 {
-			t.Message = "Transação não autorizada - Saldo na conta insuficiente - food"
-			t.Code = "500"
-		} else {
-			t.Code = "200"
-			t.Message = "Transação autorizada"
-		}
-	case "5812":
-		if (a.Amount_meal - t.Amount) < 0 {
-			t.Message = "Transação não autorizada - Saldo na conta insuficiente - food"
-			t.Code = "500"
-		} else {
-			t.Code = "200"
-			t.Message = "Transação autorizada"
+		if !t.checkCard(card, time.Now()) {
+			t.Wallet = wallet
+			return nil
 		}
+		return t.checkRules(tx, loc, wallet, origem)
 	default:
-		if (a.Amount_cash - t.Amount) < 0 {
-			t.Message = "Transação não autorizada - Saldo na conta insuficiente - food"
-			t.Code = "500"
-		} else {
-			t.Code = "200"
-			t.Message = "Transação autorizada"
-		}
+		return t.checkRules(tx, loc, wallet, origem)
 	}
 
-	// caso tenha saldo suficiente retorna erro nulo
 	return nil
-
 }
 
-// balanceOriginAccount atualiza o saldo da conta de origem
-func (t *Transaction) balanceOriginAccount(app *app.App) error {
-
-	// inicia o modo de transaction
-	tx := app.DB.Client.Begin()
+// checkRules executa as regras antifraude e, se nenhuma recusar, verifica os
+// limites e o saldo da conta de origem
+func (t *Transaction) checkRules(tx *gorm.DB, loc *time.Location, wallet string, a *Account) error {
 
-	// captura a conta de origem no DB
-	origem := &Account{}
-	if result := tx.First(&origem, &t.Accounttocredit_id); result.Error != nil {
-		tx.Rollback()
-		return errors.New("Conta de origem não encontrada")
+	triggered, err := t.screen(tx, a, time.Now(), loc)
+	if err != nil {
+		return err
 	}
-
-	// atualiza o saldo da conta de origem
-
-	switch t.Mcc {
-	case "5411":
-		origem.Amount_food = origem.Amount_food - t.Amount
-		if result := tx.Save(&origem); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de origem-food")
-		}
-		tx.Commit()
-	case "5412":
-		origem.Amount_food = origem.Amount_food - t.Amount
-		if result := tx.Save(&origem); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de origem-food")
-		}
-		tx.Commit()
-	case "5811":
-		origem.Amount_meal = origem.Amount_meal - t.Amount
-		if result := tx.Save(&origem); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de origem-meal")
-		}
-		tx.Commit()
-	case "5812":
-		origem.Amount_meal = origem.Amount_meal - t.Amount
-		if result := tx.Save(&origem); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de origem-meal")
-		}
-		tx.Commit()
-	default:
-		origem.Amount_cash = origem.Amount_cash - t.Amount
-		if result := tx.Save(&origem); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de origem-cash")
+	t.Rules = triggered
+
+	flagged := false
+	for _, r := range triggered {
+		switch r.Action {
+		case FraudDecline:
+			t.Wallet = wallet
+			t.decline(CodeSuspectedFraud, ReasonSuspectedFraud, "Transação não autorizada - Regra antifraude "+r.Rule)
+			return nil
+		case FraudFlag:
+			flagged = true
 		}
-		tx.Commit()
 	}
 
-	switch t.Code {
-	case "500":
-		origem.Amount_food = origem.Amount_food + t.Amount
-		tx.Commit()
-	default:
-		origem.Amount_food = origem.Amount_food - t.Amount
-		tx.Commit()
+	if err := t.checkOriginBalance(tx, loc, wallet, a); err != nil {
+		return err
 	}
+	t.Flagged = flagged && t.Approved()
 
-	// atualização sem erros é comitada
-	tx.Commit()
-
-	// caso sucesso retorna erro nulo
 	return nil
-
 }
 
-// balanceDestinationAccount atualiza o saldo da conta de destino
-func (t *Transaction) balanceDestinationAccount(app *app.App) error {
+// resolveWallet consulta o registro de estabelecimentos antes de aplicar o mcc
+// e retorna a carteira a ser debitada
+func (t *Transaction) resolveWallet(db *gorm.DB) (string, error) {
 
-	// inicia o modo de transaction
-	tx := app.DB.Client.Begin()
+	t.Effective_mcc = t.Mcc
 
-	// captura a conta de destino no DB
-	destino := &Account{}
-	if result := tx.First(&destino, &t.Account_id); result.Error != nil {
-		tx.Rollback()
-		return errors.New("Conta de destino não encontrada")
+	rule, err := FindMerchantRule(db, t.Merchant)
+	if err != nil {
+		return "", err
 	}
 
-	// atualiza o saldo da conta de destino
-	switch t.Mcc {
-	case "5411":
-		destino.Amount_food = destino.Amount_food - t.Amount
-		if result := tx.Save(&destino); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de destino")
-		}
-		tx.Commit()
-	case "5412":
-		destino.Amount_food = destino.Amount_food - t.Amount
-		if result := tx.Save(&destino); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de destino")
-		}
-		tx.Commit()
-	case "5811":
-		destino.Amount_meal = destino.Amount_meal - t.Amount
-		if result := tx.Save(&destino); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de destino")
-		}
-		tx.Commit()
-	case "5812":
-		destino.Amount_meal = destino.Amount_meal - t.Amount
-		if result := tx.Save(&destino); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de destino")
+	if rule != nil {
+		if rule.Mcc != "" {
+			t.Effective_mcc = rule.Mcc
 		}
 
-		tx.Commit()
-	default:
-		destino.Amount_cash = destino.Amount_cash - t.Amount
-		if result := tx.Save(&destino); result.Error != nil {
-			tx.Rollback()
-			return errors.New("Erro ao atualizar saldo da conta de destino")
+		// a categoria da regra tem prioridade sobre o mcc
+		if rule.Wallet != "" {
+			return rule.Wallet, nil
 		}
-		tx.Commit()
 	}
 
-	// atualização sem erros é comitada
-	tx.Commit()
+	// a carteira é resolvida pela tabela mcc_categories
+	return ResolveMccCategory(db, t.Effective_mcc)
 
-	// caso sucesso retorna erro nulo
+}
+
+// checkOriginBalance verifica se a conta de origem tem saldo disponível
+// suficiente, já descontados os valores bloqueados por pré-autorizações
+//
+// Antes do saldo de cada carteira são verificados os limites de gasto dela:
+// a transação que ultrapassa um limite é recusada com o código "61" mesmo que
+// haja saldo.
+func (t *Transaction) checkOriginBalance(tx *gorm.DB, loc *time.Location, wallet string, a *Account) error {
+
+	now := time.Now()
+
+	// limites da carteira da categoria do mcc
+	if exceeded, err := a.exceededLimit(tx, wallet, t.Amount, now, loc); err != nil {
+		return err
+	} else if exceeded != "" {
+		t.Wallet = wallet
+		t.decline(CodeLimitExceeded, ReasonLimitExceeded, "Transação não autorizada - "+exceeded+" - "+wallet)
+		return nil
+	}
+
+	// tenta primeiro a carteira da categoria do mcc
+	if a.available(wallet) >= t.Amount {
+		t.approve(wallet, "Transação autorizada")
+		return nil
+	}
+
+	// se permitido pela conta, usa o saldo de cash como fallback, respeitando
+	// os limites de cash
+	if wallet != WalletCash && a.Cash_fallback && a.available(WalletCash) >= t.Amount {
+		if exceeded, err := a.exceededLimit(tx, WalletCash, t.Amount, now, loc); err != nil {
+			return err
+		} else if exceeded != "" {
+			t.Wallet = WalletCash
+			t.decline(CodeLimitExceeded, ReasonLimitExceeded, "Transação não autorizada - "+exceeded+" - "+WalletCash)
+			return nil
+		}
+
+		t.approve(WalletCash, "Transação autorizada - fallback para "+WalletCash)
+		return nil
+	}
+
+	// caso não tenha saldo suficiente registra a transação como negada
+	t.Wallet = wallet
+	t.decline(CodeInsufficientFunds, ReasonInsufficientFunds, "Transação não autorizada - Saldo na conta insuficiente - "+wallet)
 	return nil
 
 }
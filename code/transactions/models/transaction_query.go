@@ -0,0 +1,252 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// situações aceitas no filtro da listagem de transações
+const (
+	StatusApproved = "approved"
+	StatusDeclined = "declined"
+)
+
+// ordenação padrão da listagem, da transação mais recente para a mais antiga
+const defaultTransactionSort = "-created"
+
+// tamanho da página na listagem de transações
+const (
+	transactionsPageDefault = 50
+	transactionsPageMax     = 200
+)
+
+// erros da consulta e da listagem de transações
+var (
+	ErrTransactionNotFound = errors.New("Transação não encontrada")
+	ErrInvalidSort         = errors.New("Parâmetro sort inválido")
+	ErrInvalidStatus       = errors.New("Parâmetro status inválido")
+	ErrInvalidCursor       = errors.New("Parâmetro cursor inválido")
+)
+
+// TransactionDetail registro completo de uma autorização: a decisão, a
+// carteira debitada, as regras antifraude disparadas e as transações ligadas
+// a ela (estornos, capturas e cancelamentos)
+type TransactionDetail struct {
+	Transaction
+	Approved bool          `json:"approved"`
+	Linked   []Transaction `json:"linked"` // TRANSAÇÕES CUJA TRANSAÇÃO ORIGINAL É ESTA
+}
+
+// transactionSort coluna e sentido de uma ordenação da listagem; o id
+// desempata transações com o mesmo valor na coluna
+type transactionSort struct {
+	column string
+	desc   bool
+}
+
+// transactionSorts ordenações aceitas no parâmetro sort
+var transactionSorts = map[string]transactionSort{
+	"-created": {column: "created_at", desc: true},
+	"created":  {column: "created_at"},
+	"-amount":  {column: "amount", desc: true},
+	"amount":   {column: "amount"},
+}
+
+// TransactionFilter filtros, ordenação e página da listagem de transações
+type TransactionFilter struct {
+	From     *time.Time   // CRIADAS A PARTIR DE
+	To       *time.Time   // CRIADAS ATÉ
+	Mcc      string       // MCC EFETIVO
+	Wallet   string       // CARTEIRA DEBITADA
+	Status   string       // approved OU declined
+	Merchant string       // TRECHO DO NOME DO ESTABELECIMENTO
+	Min      *money.Money // VALOR MÍNIMO
+	Max      *money.Money // VALOR MÁXIMO
+	Sort     string       // -created (PADRÃO), created, -amount OU amount
+	Limit    int          // TAMANHO DA PÁGINA, ATÉ 200
+	Cursor   string       // next_cursor DA PÁGINA ANTERIOR
+}
+
+// TransactionPage página da listagem de transações; next_cursor fica vazio
+// na última página
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	Next_cursor  string        `json:"next_cursor,omitempty"`
+}
+
+// transactionCursor posição da última transação de uma página; é enviado ao
+// cliente em base64 e só vale para a mesma ordenação
+type transactionCursor struct {
+	Sort string    `json:"s"`
+	Key  string    `json:"k"` // VALOR DA COLUNA ORDENADA
+	ID   uuid.UUID `json:"i"`
+}
+
+// FindTransactions lista as transações debitadas da conta com os filtros de f
+//
+// A consulta vai direto na tabela transactions, usando os índices por conta e
+// data ou valor, e a paginação é por cursor: cada página continua a partir da
+// última transação da anterior, sem OFFSET, de forma que transações novas não
+// deslocam as páginas seguintes.
+func FindTransactions(db *gorm.DB, accountID int, f *TransactionFilter) (*TransactionPage, error) {
+
+	if f.Sort == "" {
+		f.Sort = defaultTransactionSort
+	}
+	sort, ok := transactionSorts[f.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = transactionsPageDefault
+	} else if limit > transactionsPageMax {
+		limit = transactionsPageMax
+	}
+
+	query := db.Model(&Transaction{}).Where("account_id = ?", accountID)
+
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at <= ?", *f.To)
+	}
+	if f.Mcc != "" {
+		query = query.Where("effective_mcc = ?", f.Mcc)
+	}
+	if f.Wallet != "" {
+		query = query.Where("wallet = ?", f.Wallet)
+	}
+	switch f.Status {
+	case "":
+	case StatusApproved:
+		query = query.Where("code = ?", CodeApproved)
+	case StatusDeclined:
+		query = query.Where("code <> ?", CodeApproved)
+	default:
+		return nil, ErrInvalidStatus
+	}
+	if merchant := NormalizeMerchant(f.Merchant); merchant != "" {
+		query = query.Where("merchant_id IN (SELECT id FROM merchants WHERE normalized LIKE ?)", "%"+merchant+"%")
+	}
+	if f.Min != nil {
+		query = query.Where("amount >= ?", *f.Min)
+	}
+	if f.Max != nil {
+		query = query.Where("amount <= ?", *f.Max)
+	}
+
+	// continua depois da última transação da página anterior
+	if f.Cursor != "" {
+		key, id, err := decodeTransactionCursor(f.Cursor, f.Sort)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if sort.desc {
+			op = "<"
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", sort.column, op), key, id)
+	}
+
+	direction := ""
+	if sort.desc {
+		direction = " DESC"
+	}
+
+	// uma transação a mais indica que existe a próxima página
+	transactions := []Transaction{}
+	if result := query.
+		Order(sort.column + direction).
+		Order("id" + direction).
+		Limit(limit + 1).
+		Find(&transactions); result.Error != nil {
+		return nil, errors.New("Erro na listagem das transações")
+	}
+
+	page := &TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.Next_cursor = encodeTransactionCursor(f.Sort, &transactions[limit-1])
+	}
+
+	return page, nil
+}
+
+// FindTransaction retorna o registro completo da transação id; a conta
+// informada deve ser a de origem ou a de destino da transação
+func FindTransaction(db *gorm.DB, id uuid.UUID, accountID int) (*TransactionDetail, error) {
+
+	d := &TransactionDetail{Linked: []Transaction{}}
+	if result := db.Where("id = ? AND (account_id = ? OR accounttocredit_id = ?)", id, accountID, accountID).
+		Limit(1).
+		Find(&d.Transaction); result.Error != nil {
+		return nil, errors.New("Erro ao consultar a transação")
+	} else if result.RowsAffected == 0 {
+		return nil, ErrTransactionNotFound
+	}
+	d.Approved = d.Transaction.Approved()
+
+	// regras antifraude disparadas na autorização
+	if result := db.Where("transaction_id = ?", id).Order("id").Find(&d.Rules); result.Error != nil {
+		return nil, errors.New("Erro ao consultar as regras disparadas na transação")
+	}
+
+	if result := db.Where("parent_id = ?", id).Order("created_at").Order("id").Find(&d.Linked); result.Error != nil {
+		return nil, errors.New("Erro ao consultar as transações ligadas")
+	}
+
+	return d, nil
+}
+
+// encodeTransactionCursor gera o cursor opaco que continua a listagem depois de t
+func encodeTransactionCursor(sort string, t *Transaction) string {
+
+	c := transactionCursor{Sort: sort, ID: t.ID}
+	if transactionSorts[sort].column == "amount" {
+		c.Key = t.Amount.String()
+	} else {
+		c.Key = t.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeTransactionCursor lê o valor da coluna ordenada e o id do cursor,
+// que precisa ter sido gerado com a mesma ordenação
+func decodeTransactionCursor(cursor, sort string) (interface{}, uuid.UUID, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, uuid.Nil, ErrInvalidCursor
+	}
+	c := transactionCursor{}
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return nil, uuid.Nil, ErrInvalidCursor
+	}
+
+	if transactionSorts[sort].column == "amount" {
+		amount, err := money.Parse(c.Key)
+		if err != nil {
+			return nil, uuid.Nil, ErrInvalidCursor
+		}
+		return amount, c.ID, nil
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, c.Key)
+	if err != nil {
+		return nil, uuid.Nil, ErrInvalidCursor
+	}
+	return created, c.ID, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"cajueiro/pkg/money"
+
+	"github.com/google/uuid"
+)
+
+func TestTransactionCursor(t *testing.T) {
+
+	tr := &Transaction{
+		ID:        uuid.New(),
+		Amount:    money.FromCents(1050),
+		CreatedAt: time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC),
+	}
+
+	cursor := encodeTransactionCursor("-created", tr)
+	key, id, err := decodeTransactionCursor(cursor, "-created")
+	if err != nil || id != tr.ID || !key.(time.Time).Equal(tr.CreatedAt) {
+		t.Errorf("Expected %v %v. Got %v %v %v", tr.CreatedAt, tr.ID, key, id, err)
+	}
+
+	cursor = encodeTransactionCursor("amount", tr)
+	key, id, err = decodeTransactionCursor(cursor, "amount")
+	if err != nil || id != tr.ID || key.(money.Money) != tr.Amount {
+		t.Errorf("Expected %v %v. Got %v %v %v", tr.Amount, tr.ID, key, id, err)
+	}
+
+	// o cursor só vale para a ordenação em que foi gerado
+	if _, _, err := decodeTransactionCursor(cursor, "-amount"); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for another sort. Got %v", err)
+	}
+	if _, _, err := decodeTransactionCursor("não é base64", "amount"); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor. Got %v", err)
+	}
+}
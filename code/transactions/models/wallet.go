@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"cajueiro/pkg/app"
+	"cajueiro/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// Wallet modelo para o saldo de uma categoria de benefício da conta
+type Wallet struct {
+	ID         int         `json:"-" gorm:"primaryKey"`
+	Account_id int         `json:"-" gorm:"not null;uniqueIndex:idx_wallets_account_category"`
+	Category   string      `json:"category" gorm:"not null;uniqueIndex:idx_wallets_account_category" validate:"required,category"`
+	Balance    money.Money `json:"balance" gorm:"not null;default:0" validate:"gte=0"`
+	Held       money.Money `json:"held" gorm:"not null;default:0"` // BLOQUEADO POR PRÉ-AUTORIZAÇÕES
+	CreatedAt  time.Time   `json:"-"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// newWallets monta uma carteira para cada categoria configurada, usando o
+// saldo inicial informado na criação da conta
+func newWallets(app *app.App, initial []Wallet) ([]Wallet, error) {
+
+	balances := map[string]money.Money{}
+	for _, w := range initial {
+		if !app.Cfg.IsWalletCategory(w.Category) {
+			return nil, errors.New("Categoria de carteira inválida: " + w.Category)
+		}
+		if _, ok := balances[w.Category]; ok {
+			return nil, errors.New("Categoria de carteira repetida: " + w.Category)
+		}
+		balances[w.Category] = w.Balance
+	}
+
+	var wallets []Wallet
+	for _, category := range app.Cfg.GetWalletCategories() {
+		wallets = append(wallets, Wallet{Category: category, Balance: balances[category]})
+	}
+
+	return wallets, nil
+}
+
+// Available retorna o saldo disponível para novas autorizações
+func (w *Wallet) Available() money.Money {
+	return w.Balance - w.Held
+}
+
+// WalletBalance saldo de uma categoria: o saldo contábil, o valor bloqueado
+// por pré-autorizações e o disponível para novas autorizações
+type WalletBalance struct {
+	Balance   money.Money      `json:"balance"`
+	Held      money.Money      `json:"held"`
+	Available money.Money      `json:"available"`
+	Expiring  []ExpiringAmount `json:"expiring,omitempty"` // CRÉDITOS COM VALIDADE POR DATA DE VENCIMENTO
+}
+
+// Balances retorna o saldo de cada categoria configurada, com zero para as
+// categorias em que a conta ainda não tem carteira, e os valores que vencem
+// em cada data
+func (a *Account) Balances(app *app.App, db *gorm.DB) (map[string]WalletBalance, error) {
+
+	expiring, err := a.ExpiringCredits(db, app.Cfg.GetLocation())
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[string]WalletBalance{}
+	for _, category := range app.Cfg.GetWalletCategories() {
+		balances[category] = WalletBalance{}
+	}
+	for _, w := range a.Wallets {
+		balances[w.Category] = WalletBalance{
+			Balance:   w.Balance,
+			Held:      w.Held,
+			Available: w.Available(),
+			Expiring:  expiring[w.Category],
+		}
+	}
+
+	return balances, nil
+}
@@ -2,10 +2,16 @@ package routers
 
 import (
 	"cajueiro/code/transactions/handlers/account"
+	"cajueiro/code/transactions/handlers/employer"
+	"cajueiro/code/transactions/handlers/fraudrule"
+	"cajueiro/code/transactions/handlers/ledger"
 	"cajueiro/code/transactions/handlers/login"
+	"cajueiro/code/transactions/handlers/mcccategory"
 	"cajueiro/code/transactions/handlers/merchant"
+	"cajueiro/code/transactions/handlers/merchantrule"
 	"cajueiro/code/transactions/handlers/transaction"
 	"cajueiro/pkg/app"
+	"cajueiro/pkg/middleware"
 
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
@@ -19,6 +25,9 @@ func GetRouter(app *app.App) *mux.Router {
 		negroni.NewLogger(),
 	)
 
+	// middleware das rotas administrativas
+	admin := middleware.Admin(app.Cfg.GetAdminToken())
+
 	// criando roteador base
 	router := mux.NewRouter()
 
@@ -47,6 +56,99 @@ func GetRouter(app *app.App) *mux.Router {
 	balances := balanceRoutes.Path("/accounts/{id}/balance").Subrouter()
 	balances.Methods("GET").HandlerFunc(account.BalanceAccount(app))
 
+	// rota de extrato
+	statementRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/statement").Handler(common.With(
+		negroni.Wrap(statementRoutes),
+	))
+	statements := statementRoutes.Path("/accounts/{id}/statement").Subrouter()
+	statements.Methods("GET").HandlerFunc(account.StatementAccount(app))
+
+	// rotas de manutenção da conta (administrativas)
+	accountRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}").Handler(common.With(
+		negroni.Wrap(accountRoutes),
+	))
+	accountRoute := accountRoutes.Path("/accounts/{id}").Subrouter()
+	accountRoute.Methods("GET").HandlerFunc(middleware.Chain(account.GetAccount(app), admin))
+	accountRoute.Methods("PATCH").HandlerFunc(middleware.Chain(account.PatchAccount(app), admin))
+	accountRoute.Methods("DELETE").HandlerFunc(middleware.Chain(account.CloseAccount(app), admin))
+
+	accountBlockRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/block").Handler(common.With(
+		negroni.Wrap(accountBlockRoutes),
+	))
+	accountBlock := accountBlockRoutes.Path("/accounts/{id}/block").Subrouter()
+	accountBlock.Methods("POST").HandlerFunc(middleware.Chain(account.BlockAccount(app), admin))
+
+	accountUnblockRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/unblock").Handler(common.With(
+		negroni.Wrap(accountUnblockRoutes),
+	))
+	accountUnblock := accountUnblockRoutes.Path("/accounts/{id}/unblock").Subrouter()
+	accountUnblock.Methods("POST").HandlerFunc(middleware.Chain(account.UnblockAccount(app), admin))
+
+	accountRestoreRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/restore").Handler(common.With(
+		negroni.Wrap(accountRestoreRoutes),
+	))
+	accountRestore := accountRestoreRoutes.Path("/accounts/{id}/restore").Subrouter()
+	accountRestore.Methods("POST").HandlerFunc(middleware.Chain(account.RestoreAccount(app), admin))
+
+	// rota das transações da conta para os operadores (administrativa)
+	accountTransactionsRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/transactions").Handler(common.With(
+		negroni.Wrap(accountTransactionsRoutes),
+	))
+	accountTransactions := accountTransactionsRoutes.Path("/accounts/{id}/transactions").Subrouter()
+	accountTransactions.Methods("GET").HandlerFunc(middleware.Chain(transaction.ListAccountTransactions(app), admin))
+
+	// rotas dos limites de gasto das carteiras; só o operador altera os limites
+	limitsRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/limits").Handler(common.With(
+		negroni.Wrap(limitsRoutes),
+	))
+	limits := limitsRoutes.Path("/accounts/{id}/limits").Subrouter()
+	limits.Methods("GET").HandlerFunc(account.ListLimits(app))
+
+	limitRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/limits/{wallet}").Handler(common.With(
+		negroni.Wrap(limitRoutes),
+	))
+	limit := limitRoutes.Path("/accounts/{id}/limits/{wallet}").Subrouter()
+	limit.Methods("PUT").HandlerFunc(middleware.Chain(account.PutLimit(app), admin))
+	limit.Methods("DELETE").HandlerFunc(middleware.Chain(account.DeleteLimit(app), admin))
+
+	// rotas dos cartões da conta
+	cardsRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/cards").Handler(common.With(
+		negroni.Wrap(cardsRoutes),
+	))
+	cards := cardsRoutes.Path("/accounts/{id}/cards").Subrouter()
+	cards.Methods("GET").HandlerFunc(account.ListCards(app))
+	cards.Methods("POST").HandlerFunc(account.IssueCard(app))
+
+	cardBlockRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/cards/{token}/block").Handler(common.With(
+		negroni.Wrap(cardBlockRoutes),
+	))
+	cardBlock := cardBlockRoutes.Path("/accounts/{id}/cards/{token}/block").Subrouter()
+	cardBlock.Methods("POST").HandlerFunc(account.BlockCard(app))
+
+	cardUnblockRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/cards/{token}/unblock").Handler(common.With(
+		negroni.Wrap(cardUnblockRoutes),
+	))
+	cardUnblock := cardUnblockRoutes.Path("/accounts/{id}/cards/{token}/unblock").Subrouter()
+	cardUnblock.Methods("POST").HandlerFunc(account.UnblockCard(app))
+
+	cardCancelRoutes := mux.NewRouter()
+	router.Path("/accounts/{id}/cards/{token}/cancel").Handler(common.With(
+		negroni.Wrap(cardCancelRoutes),
+	))
+	cardCancel := cardCancelRoutes.Path("/accounts/{id}/cards/{token}/cancel").Subrouter()
+	cardCancel.Methods("POST").HandlerFunc(account.CancelCard(app))
+
 	// rota de transações (transactions)
 	transactionsRoutes := mux.NewRouter()
 	router.Path("/transactions").Handler(common.With(
@@ -56,13 +158,171 @@ func GetRouter(app *app.App) *mux.Router {
 	transactions.Methods("GET").HandlerFunc(transaction.ListTransactions(app))
 	transactions.Methods("POST").HandlerFunc(transaction.PostTransactions(app))
 
-	// rota de estabelecimentos
+	transactionRoutes := mux.NewRouter()
+	router.Path("/transactions/{id}").Handler(common.With(
+		negroni.Wrap(transactionRoutes),
+	))
+	transactionRoute := transactionRoutes.Path("/transactions/{id}").Subrouter()
+	transactionRoute.Methods("GET").HandlerFunc(transaction.GetTransaction(app))
+
+	// rotas de captura e cancelamento de pré-autorizações
+	captureRoutes := mux.NewRouter()
+	router.Path("/transactions/{id}/capture").Handler(common.With(
+		negroni.Wrap(captureRoutes),
+	))
+	capture := captureRoutes.Path("/transactions/{id}/capture").Subrouter()
+	capture.Methods("POST").HandlerFunc(transaction.CaptureTransaction(app))
+
+	voidRoutes := mux.NewRouter()
+	router.Path("/transactions/{id}/void").Handler(common.With(
+		negroni.Wrap(voidRoutes),
+	))
+	void := voidRoutes.Path("/transactions/{id}/void").Subrouter()
+	void.Methods("POST").HandlerFunc(transaction.VoidTransaction(app))
+
+	// rota de estorno de transações
+	reversalRoutes := mux.NewRouter()
+	router.Path("/transactions/{id}/reversal").Handler(common.With(
+		negroni.Wrap(reversalRoutes),
+	))
+	reversal := reversalRoutes.Path("/transactions/{id}/reversal").Subrouter()
+	reversal.Methods("POST").HandlerFunc(transaction.ReverseTransaction(app))
+
+	// rotas de estabelecimentos; o cadastro é alterado apenas com o token administrativo
 	merchantsRoutes := mux.NewRouter()
-	router.Path("/merchants/{merchant}").Handler(common.With(
+	router.Path("/merchants").Handler(common.With(
 		negroni.Wrap(merchantsRoutes),
 	))
-	merchants := merchantsRoutes.Path("/merchants/{merchant}").Subrouter()
+	merchants := merchantsRoutes.Path("/merchants").Subrouter()
 	merchants.Methods("GET").HandlerFunc(merchant.ListMerchants(app))
+	merchants.Methods("POST").HandlerFunc(middleware.Chain(merchant.PostMerchant(app), admin))
+
+	merchantRoutes := mux.NewRouter()
+	router.Path("/merchants/{id}").Handler(common.With(
+		negroni.Wrap(merchantRoutes),
+	))
+	merchantRoute := merchantRoutes.Path("/merchants/{id}").Subrouter()
+	merchantRoute.Methods("GET").HandlerFunc(merchant.GetMerchant(app))
+	merchantRoute.Methods("PUT").HandlerFunc(middleware.Chain(merchant.PutMerchant(app), admin))
+	merchantRoute.Methods("DELETE").HandlerFunc(middleware.Chain(merchant.DeleteMerchant(app), admin))
+
+	// rota do registro de estabelecimentos (administrativa)
+	merchantRulesRoutes := mux.NewRouter()
+	router.Path("/admin/merchant-rules").Handler(common.With(
+		negroni.Wrap(merchantRulesRoutes),
+	))
+	merchantRules := merchantRulesRoutes.Path("/admin/merchant-rules").Subrouter()
+	merchantRules.Methods("GET").HandlerFunc(middleware.Chain(merchantrule.ListMerchantRules(app), admin))
+	merchantRules.Methods("POST").HandlerFunc(middleware.Chain(merchantrule.PostMerchantRule(app), admin))
+
+	merchantRuleRoutes := mux.NewRouter()
+	router.Path("/admin/merchant-rules/{id}").Handler(common.With(
+		negroni.Wrap(merchantRuleRoutes),
+	))
+	merchantRule := merchantRuleRoutes.Path("/admin/merchant-rules/{id}").Subrouter()
+	merchantRule.Methods("PUT").HandlerFunc(middleware.Chain(merchantrule.PutMerchantRule(app), admin))
+	merchantRule.Methods("DELETE").HandlerFunc(middleware.Chain(merchantrule.DeleteMerchantRule(app), admin))
+
+	// rota do mapeamento de mcc para categoria (administrativa)
+	mccCategoriesRoutes := mux.NewRouter()
+	router.Path("/admin/mcc-categories").Handler(common.With(
+		negroni.Wrap(mccCategoriesRoutes),
+	))
+	mccCategories := mccCategoriesRoutes.Path("/admin/mcc-categories").Subrouter()
+	mccCategories.Methods("GET").HandlerFunc(middleware.Chain(mcccategory.ListMccCategories(app), admin))
+	mccCategories.Methods("POST").HandlerFunc(middleware.Chain(mcccategory.PostMccCategory(app), admin))
+
+	mccCategoryRoutes := mux.NewRouter()
+	router.Path("/admin/mcc-categories/{id}").Handler(common.With(
+		negroni.Wrap(mccCategoryRoutes),
+	))
+	mccCategory := mccCategoryRoutes.Path("/admin/mcc-categories/{id}").Subrouter()
+	mccCategory.Methods("PUT").HandlerFunc(middleware.Chain(mcccategory.PutMccCategory(app), admin))
+	mccCategory.Methods("DELETE").HandlerFunc(middleware.Chain(mcccategory.DeleteMccCategory(app), admin))
+
+	// rotas das regras antifraude (administrativas)
+	fraudRulesRoutes := mux.NewRouter()
+	router.Path("/admin/fraud-rules").Handler(common.With(
+		negroni.Wrap(fraudRulesRoutes),
+	))
+	fraudRules := fraudRulesRoutes.Path("/admin/fraud-rules").Subrouter()
+	fraudRules.Methods("GET").HandlerFunc(middleware.Chain(fraudrule.ListFraudRules(app), admin))
+	fraudRules.Methods("POST").HandlerFunc(middleware.Chain(fraudrule.PostFraudRule(app), admin))
+
+	fraudRuleRoutes := mux.NewRouter()
+	router.Path("/admin/fraud-rules/{id}").Handler(common.With(
+		negroni.Wrap(fraudRuleRoutes),
+	))
+	fraudRule := fraudRuleRoutes.Path("/admin/fraud-rules/{id}").Subrouter()
+	fraudRule.Methods("PUT").HandlerFunc(middleware.Chain(fraudrule.PutFraudRule(app), admin))
+	fraudRule.Methods("DELETE").HandlerFunc(middleware.Chain(fraudrule.DeleteFraudRule(app), admin))
+
+	// rotas dos empregadores e dos créditos agendados (administrativas)
+	employersRoutes := mux.NewRouter()
+	router.Path("/admin/employers").Handler(common.With(
+		negroni.Wrap(employersRoutes),
+	))
+	employers := employersRoutes.Path("/admin/employers").Subrouter()
+	employers.Methods("GET").HandlerFunc(middleware.Chain(employer.ListEmployers(app), admin))
+	employers.Methods("POST").HandlerFunc(middleware.Chain(employer.PostEmployer(app), admin))
+
+	employerRoutes := mux.NewRouter()
+	router.Path("/admin/employers/{id}").Handler(common.With(
+		negroni.Wrap(employerRoutes),
+	))
+	employerRoute := employerRoutes.Path("/admin/employers/{id}").Subrouter()
+	employerRoute.Methods("GET").HandlerFunc(middleware.Chain(employer.GetEmployer(app), admin))
+
+	schedulesRoutes := mux.NewRouter()
+	router.Path("/admin/employers/{id}/schedules").Handler(common.With(
+		negroni.Wrap(schedulesRoutes),
+	))
+	schedules := schedulesRoutes.Path("/admin/employers/{id}/schedules").Subrouter()
+	schedules.Methods("POST").HandlerFunc(middleware.Chain(employer.PostCreditSchedule(app), admin))
+
+	scheduleRoutes := mux.NewRouter()
+	router.Path("/admin/employers/{id}/schedules/{schedule}").Handler(common.With(
+		negroni.Wrap(scheduleRoutes),
+	))
+	schedule := scheduleRoutes.Path("/admin/employers/{id}/schedules/{schedule}").Subrouter()
+	schedule.Methods("DELETE").HandlerFunc(middleware.Chain(employer.DeleteCreditSchedule(app), admin))
+
+	employerAccountRoutes := mux.NewRouter()
+	router.Path("/admin/employers/{id}/accounts/{account}").Handler(common.With(
+		negroni.Wrap(employerAccountRoutes),
+	))
+	employerAccount := employerAccountRoutes.Path("/admin/employers/{id}/accounts/{account}").Subrouter()
+	employerAccount.Methods("PUT").HandlerFunc(middleware.Chain(employer.LinkAccount(app), admin))
+
+	// rotas dos lotes da folha de benefícios (administrativas)
+	employerPayrollRoutes := mux.NewRouter()
+	router.Path("/admin/employers/{id}/payroll").Handler(common.With(
+		negroni.Wrap(employerPayrollRoutes),
+	))
+	employerPayroll := employerPayrollRoutes.Path("/admin/employers/{id}/payroll").Subrouter()
+	employerPayroll.Methods("POST").HandlerFunc(middleware.Chain(employer.PostPayroll(app), admin))
+
+	payrollRoutes := mux.NewRouter()
+	router.Path("/admin/payroll/{id}").Handler(common.With(
+		negroni.Wrap(payrollRoutes),
+	))
+	payroll := payrollRoutes.Path("/admin/payroll/{id}").Subrouter()
+	payroll.Methods("GET").HandlerFunc(middleware.Chain(employer.GetPayroll(app), admin))
+
+	payrollResumeRoutes := mux.NewRouter()
+	router.Path("/admin/payroll/{id}/resume").Handler(common.With(
+		negroni.Wrap(payrollResumeRoutes),
+	))
+	payrollResume := payrollResumeRoutes.Path("/admin/payroll/{id}/resume").Subrouter()
+	payrollResume.Methods("POST").HandlerFunc(middleware.Chain(employer.ResumePayroll(app), admin))
+
+	// rota de verificação do livro-razão (administrativa)
+	ledgerRoutes := mux.NewRouter()
+	router.Path("/admin/ledger/check").Handler(common.With(
+		negroni.Wrap(ledgerRoutes),
+	))
+	ledgerCheck := ledgerRoutes.Path("/admin/ledger/check").Subrouter()
+	ledgerCheck.Methods("GET").HandlerFunc(middleware.Chain(ledger.CheckLedger(app), admin))
 
 	return router
 }
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"strings"
 
 	"cajueiro/pkg/config"
 	"cajueiro/pkg/db"
@@ -35,6 +36,20 @@ func (app *App) TranslateErrors(err error) (errs []error) {
 	return errs
 }
 
+// registerCategoryValidation registra a tag "category" que aceita apenas as
+// categorias de carteira configuradas em WALLET_CATEGORIES
+func registerCategoryValidation(vld *validator.Validate, trans ut.Translator, cfg *config.Config) {
+	_ = vld.RegisterValidation("category", func(fl validator.FieldLevel) bool {
+		return cfg.IsWalletCategory(fl.Field().String())
+	})
+	_ = vld.RegisterTranslation("category", trans, func(ut ut.Translator) error {
+		return ut.Add("category", "{0} deve ser uma das categorias: {1}", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("category", fe.Field(), strings.Join(cfg.GetWalletCategories(), ", "))
+		return t
+	})
+}
+
 // GetApp captura variáveis de ambiente e conecta ao DB
 func GetApp() (*App, error) {
 	// definindo default logger
@@ -47,6 +62,8 @@ func GetApp() (*App, error) {
 	_ = br_translations.RegisterDefaultTranslations(vld, trans)
 	// definindo configurações de ambiente
 	cfg := config.GetConfig()
+	// validação das categorias de carteira configuradas
+	registerCategoryValidation(vld, trans, cfg)
 	// definindo conexão com o banco de dados
 	db, err := db.GetDB(cfg.GetDBConnStr(), cfg.GetDebugMode())
 	if err != nil {
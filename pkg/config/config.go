@@ -2,6 +2,12 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
+	// base de fusos horários embutida no binário, para que America/Sao_Paulo
+	// carregue mesmo em imagens sem o pacote tzdata
+	_ "time/tzdata"
 
 	"github.com/spf13/viper"
 )
@@ -9,6 +15,7 @@ import (
 // Config armazena as variáveis de ambiente
 type Config struct {
 	tokenKey string
+	panKey   string
 	apiPort  string
 	dbUser   string
 	dbPass   string
@@ -16,6 +23,23 @@ type Config struct {
 	dbPort   string
 	dbName   string
 	debug    string
+	admin    string
+	mccFile  string
+	wallets  []string
+	isoPort  string
+	timeout  time.Duration
+	holdTTL  time.Duration
+	location *time.Location
+	topUps   time.Duration
+}
+
+// MccCategory faixa de mcc associada a uma categoria de carteira no arquivo
+// de configuração; Mcc define um único código, From e To uma faixa
+type MccCategory struct {
+	Mcc      string `mapstructure:"mcc"`
+	From     string `mapstructure:"from"`
+	To       string `mapstructure:"to"`
+	Category string `mapstructure:"category"`
 }
 
 // GetConfig captura os valores das variáveis de ambiente
@@ -29,11 +53,85 @@ func GetConfig() *Config {
 	conf.dbPass = viper.GetString(`POSTGRES_PASSWORD`)
 	conf.dbName = viper.GetString(`POSTGRES_DB`)
 	conf.apiPort = viper.GetString(`SERVER_ADDRESS`)
+	conf.isoPort = viper.GetString(`ISO_SERVER_ADDRESS`)
 	conf.tokenKey = viper.GetString(`TOKEN_KEY`)
+	conf.panKey = viper.GetString(`PAN_HASH_KEY`)
+	conf.admin = viper.GetString(`ADMIN_TOKEN`)
+	conf.mccFile = viper.GetString(`MCC_CATEGORIES_FILE`)
+	conf.wallets = parseWalletCategories(viper.GetString(`WALLET_CATEGORIES`))
+	conf.timeout = parseAuthTimeout(viper.GetInt(`AUTH_TIMEOUT_MS`))
+	conf.holdTTL = parseHoldExpiry(viper.GetInt(`HOLD_EXPIRY_HOURS`))
+	conf.location = parseLocation(viper.GetString(`TIMEZONE`))
+	conf.topUps = parseTopUpInterval(viper.GetInt(`TOP_UP_INTERVAL_MINUTES`))
 
 	return conf
 }
 
+// parseWalletCategories lê a lista de categorias separadas por vírgula;
+// a categoria cash é sempre incluída por ser a carteira de fallback
+func parseWalletCategories(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		list = "food,meal,cash"
+	}
+
+	var categories []string
+	seen := map[string]bool{}
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		categories = append(categories, c)
+	}
+
+	if !seen["cash"] {
+		categories = append(categories, "cash")
+	}
+
+	return categories
+}
+
+// parseAuthTimeout converte o orçamento de latência em milissegundos;
+// valores ausentes ou inválidos usam o padrão de 100ms
+func parseAuthTimeout(ms int) time.Duration {
+	if ms <= 0 {
+		ms = 100
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// parseHoldExpiry converte a validade das pré-autorizações em horas;
+// valores ausentes ou inválidos usam o padrão de 7 dias
+func parseHoldExpiry(hours int) time.Duration {
+	if hours <= 0 {
+		hours = 7 * 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// parseLocation carrega o fuso horário usado no calendário dos benefícios;
+// o padrão é America/Sao_Paulo e um fuso desconhecido cai para UTC
+func parseLocation(name string) *time.Location {
+	if name == "" {
+		name = "America/Sao_Paulo"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// parseTopUpInterval converte o intervalo entre as verificações dos créditos
+// agendados em minutos; valores ausentes ou inválidos usam o padrão de 15 minutos
+func parseTopUpInterval(minutes int) time.Duration {
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
 // GetDBConnStr retorna a string da conexão com DB formatada
 func (c *Config) GetDBConnStr() string {
 	return c.getDBConnStr(c.dbHost, c.dbName)
@@ -56,6 +154,34 @@ func (c *Config) GetAPIPort() string {
 	return ":" + c.apiPort
 }
 
+// GetISOPort retorna a porta do servidor ISO 8583, vazio se desabilitado
+func (c *Config) GetISOPort() string {
+	if c.isoPort == "" {
+		return ""
+	}
+	return ":" + c.isoPort
+}
+
+// GetAuthTimeout retorna o tempo máximo de uma autorização
+func (c *Config) GetAuthTimeout() time.Duration {
+	return c.timeout
+}
+
+// GetHoldExpiry retorna a validade de uma pré-autorização não capturada
+func (c *Config) GetHoldExpiry() time.Duration {
+	return c.holdTTL
+}
+
+// GetLocation retorna o fuso horário do calendário dos benefícios
+func (c *Config) GetLocation() *time.Location {
+	return c.location
+}
+
+// GetTopUpInterval retorna o intervalo entre as verificações dos créditos agendados
+func (c *Config) GetTopUpInterval() time.Duration {
+	return c.topUps
+}
+
 // GetDebugMode retorna o valor do modo de debug
 func (c *Config) GetDebugMode() string {
 	return c.debug
@@ -65,3 +191,49 @@ func (c *Config) GetDebugMode() string {
 func (c *Config) GetTokenKey() string {
 	return c.tokenKey
 }
+
+// GetPANKey retorna a chave secreta do HMAC que identifica o PAN dos cartões
+func (c *Config) GetPANKey() string {
+	return c.panKey
+}
+
+// GetAdminToken retorna o token exigido nas rotas administrativas
+func (c *Config) GetAdminToken() string {
+	return c.admin
+}
+
+// GetMccCategories lê o arquivo YAML/JSON de MCC_CATEGORIES_FILE com o
+// mapeamento de mcc para categoria; sem arquivo configurado retorna nil
+func (c *Config) GetMccCategories() ([]MccCategory, error) {
+	if c.mccFile == "" {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(c.mccFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Falha ao carregar %s: %v", c.mccFile, err)
+	}
+
+	var categories []MccCategory
+	if err := v.UnmarshalKey("categories", &categories); err != nil {
+		return nil, fmt.Errorf("Formato inválido em %s: %v", c.mccFile, err)
+	}
+
+	return categories, nil
+}
+
+// GetWalletCategories retorna as categorias de carteira configuradas
+func (c *Config) GetWalletCategories() []string {
+	return c.wallets
+}
+
+// IsWalletCategory verifica se a categoria está configurada
+func (c *Config) IsWalletCategory(category string) bool {
+	for _, w := range c.wallets {
+		if w == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package iso8583
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tipos de campo da ISO 8583
+const (
+	fixed  = iota // TAMANHO FIXO
+	llvar         // TAMANHO VARIÁVEL COM 2 DÍGITOS DE PREFIXO
+	lllvar        // TAMANHO VARIÁVEL COM 3 DÍGITOS DE PREFIXO
+)
+
+// spec define o formato de um campo (data element)
+type spec struct {
+	kind    int
+	length  int  // TAMANHO FIXO OU TAMANHO MÁXIMO
+	numeric bool // CAMPO n, PREENCHIDO COM ZEROS À ESQUERDA
+}
+
+// specs campos suportados, em ASCII
+var specs = map[int]spec{
+	2:   {llvar, 19, true},    // PAN
+	3:   {fixed, 6, true},     // CÓDIGO DE PROCESSAMENTO
+	4:   {fixed, 12, true},    // VALOR DA TRANSAÇÃO EM CENTAVOS
+	7:   {fixed, 10, true},    // DATA E HORA DA TRANSMISSÃO (MMDDhhmmss)
+	11:  {fixed, 6, true},     // STAN
+	12:  {fixed, 6, true},     // HORA LOCAL (hhmmss)
+	13:  {fixed, 4, true},     // DATA LOCAL (MMDD)
+	14:  {fixed, 4, true},     // VALIDADE DO CARTÃO (YYMM)
+	18:  {fixed, 4, true},     // MCC
+	22:  {fixed, 3, true},     // MODO DE ENTRADA
+	32:  {llvar, 11, true},    // CÓDIGO DO ADQUIRENTE
+	37:  {fixed, 12, false},   // RRN
+	38:  {fixed, 6, false},    // CÓDIGO DE AUTORIZAÇÃO
+	39:  {fixed, 2, false},    // CÓDIGO DE RESPOSTA
+	41:  {fixed, 8, false},    // TERMINAL
+	42:  {fixed, 15, false},   // CÓDIGO DO ESTABELECIMENTO
+	43:  {fixed, 40, false},   // NOME E LOCALIZAÇÃO DO ESTABELECIMENTO
+	49:  {fixed, 3, true},     // MOEDA
+	102: {llvar, 28, false},   // IDENTIFICAÇÃO DA CONTA
+	120: {lllvar, 999, false}, // DADOS PRIVADOS
+}
+
+// erros do codec
+var (
+	ErrShortMessage = errors.New("Mensagem ISO 8583 incompleta")
+	ErrInvalidMTI   = errors.New("MTI inválido")
+)
+
+// Message mensagem ISO 8583 com o MTI e os campos em texto
+type Message struct {
+	MTI    string
+	Fields map[int]string
+}
+
+// NewMessage cria uma mensagem vazia com o MTI informado
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, Fields: map[int]string{}}
+}
+
+// Get retorna o valor do campo, vazio se ausente
+func (m *Message) Get(field int) string {
+	return m.Fields[field]
+}
+
+// Set define o valor do campo
+func (m *Message) Set(field int, value string) {
+	m.Fields[field] = value
+}
+
+// Has verifica se o campo está presente
+func (m *Message) Has(field int) bool {
+	_, ok := m.Fields[field]
+	return ok
+}
+
+// ResponseMTI retorna o MTI de resposta (0100 -> 0110, 0200 -> 0210)
+func ResponseMTI(mti string) string {
+	if len(mti) != 4 {
+		return mti
+	}
+	function := mti[2]
+	if function%2 == 0 {
+		function++
+	}
+	return mti[:2] + string(function) + mti[3:]
+}
+
+// Pack codifica a mensagem: MTI, bitmap binário e campos em ASCII
+func (m *Message) Pack() ([]byte, error) {
+	if len(m.MTI) != 4 || !isNumeric(m.MTI) {
+		return nil, ErrInvalidMTI
+	}
+
+	fields := make([]int, 0, len(m.Fields))
+	for f := range m.Fields {
+		if _, ok := specs[f]; !ok {
+			return nil, fmt.Errorf("Campo %d não suportado", f)
+		}
+		fields = append(fields, f)
+	}
+	sort.Ints(fields)
+
+	// bitmap primário e, se houver campos acima de 64, secundário
+	bitmap := make([]byte, 8)
+	if len(fields) > 0 && fields[len(fields)-1] > 64 {
+		bitmap = make([]byte, 16)
+		bitmap[0] |= 0x80
+	}
+	for _, f := range fields {
+		bitmap[(f-1)/8] |= 0x80 >> uint((f-1)%8)
+	}
+
+	out := append([]byte(m.MTI), bitmap...)
+	for _, f := range fields {
+		value, err := encodeField(f, m.Fields[f])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value...)
+	}
+
+	return out, nil
+}
+
+// encodeField formata o valor do campo de acordo com a especificação
+func encodeField(f int, value string) ([]byte, error) {
+	s := specs[f]
+
+	if s.numeric && !isNumeric(value) {
+		return nil, fmt.Errorf("Campo %d deve ser numérico", f)
+	}
+	if len(value) > s.length {
+		return nil, fmt.Errorf("Campo %d excede %d caracteres", f, s.length)
+	}
+
+	switch s.kind {
+	case llvar:
+		return []byte(fmt.Sprintf("%02d%s", len(value), value)), nil
+	case lllvar:
+		return []byte(fmt.Sprintf("%03d%s", len(value), value)), nil
+	}
+
+	if s.numeric {
+		return []byte(strings.Repeat("0", s.length-len(value)) + value), nil
+	}
+	return []byte(value + strings.Repeat(" ", s.length-len(value))), nil
+}
+
+// Unpack decodifica uma mensagem gerada por Pack
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < 12 {
+		return nil, ErrShortMessage
+	}
+
+	m := NewMessage(string(b[:4]))
+	if !isNumeric(m.MTI) {
+		return nil, ErrInvalidMTI
+	}
+
+	bitmap := b[4:12]
+	pos := 12
+	if bitmap[0]&0x80 != 0 {
+		if len(b) < 20 {
+			return nil, ErrShortMessage
+		}
+		bitmap = b[4:20]
+		pos = 20
+	}
+
+	for f := 2; f <= len(bitmap)*8; f++ {
+		if bitmap[(f-1)/8]&(0x80>>uint((f-1)%8)) == 0 {
+			continue
+		}
+
+		s, ok := specs[f]
+		if !ok {
+			return nil, fmt.Errorf("Campo %d não suportado", f)
+		}
+
+		length := s.length
+		switch s.kind {
+		case llvar, lllvar:
+			digits := 2
+			if s.kind == lllvar {
+				digits = 3
+			}
+			if len(b) < pos+digits {
+				return nil, ErrShortMessage
+			}
+			n, err := strconv.Atoi(string(b[pos : pos+digits]))
+			if err != nil || n > s.length {
+				return nil, fmt.Errorf("Tamanho inválido no campo %d", f)
+			}
+			pos += digits
+			length = n
+		}
+
+		if len(b) < pos+length {
+			return nil, ErrShortMessage
+		}
+		value := string(b[pos : pos+length])
+		pos += length
+
+		if s.numeric && !isNumeric(value) {
+			return nil, fmt.Errorf("Campo %d deve ser numérico", f)
+		}
+		if s.kind == fixed && !s.numeric {
+			value = strings.TrimRight(value, " ")
+		}
+
+		m.Fields[f] = value
+	}
+
+	if pos != len(b) {
+		return nil, errors.New("Mensagem ISO 8583 com bytes excedentes")
+	}
+
+	return m, nil
+}
+
+// ReadFrame lê uma mensagem prefixada com o tamanho em 2 bytes big-endian
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// WriteFrame escreve a mensagem prefixada com o tamanho em 2 bytes big-endian
+func WriteFrame(w io.Writer, b []byte) error {
+	if len(b) > 0xFFFF {
+		return errors.New("Mensagem ISO 8583 muito grande")
+	}
+
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// isNumeric verifica se a string contém apenas dígitos
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// HandlerFunc processa uma mensagem de requisição e retorna a resposta
+type HandlerFunc func(req *Message) *Message
@@ -0,0 +1,118 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+
+	m := NewMessage("0200")
+	m.Set(2, "4111111111111111")
+	m.Set(3, "0")
+	m.Set(4, "1050")
+	m.Set(11, "123456")
+	m.Set(18, "5812")
+	m.Set(42, "2")
+	m.Set(43, "UBER EATS               SAO PAULO    BR")
+	m.Set(102, "ACC-1")
+
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: unexpected error %v", err)
+	}
+
+	// secundário presente por causa do campo 102
+	if b[4]&0x80 == 0 {
+		t.Errorf("Expected secondary bitmap bit to be set")
+	}
+
+	u, err := Unpack(b)
+	if err != nil {
+		t.Fatalf("Unpack: unexpected error %v", err)
+	}
+
+	expected := map[int]string{
+		2:   "4111111111111111",
+		3:   "000000",
+		4:   "000000001050",
+		11:  "123456",
+		18:  "5812",
+		42:  "2",
+		43:  "UBER EATS               SAO PAULO    BR",
+		102: "ACC-1",
+	}
+
+	if u.MTI != "0200" {
+		t.Errorf("Expected MTI 0200. Got %s", u.MTI)
+	}
+	if len(u.Fields) != len(expected) {
+		t.Errorf("Expected %d fields. Got %d", len(expected), len(u.Fields))
+	}
+	for f, v := range expected {
+		if u.Get(f) != v {
+			t.Errorf("Field %d: expected %q. Got %q", f, v, u.Get(f))
+		}
+	}
+}
+
+func TestPackRejectsInvalidFields(t *testing.T) {
+
+	m := NewMessage("0100")
+	m.Set(4, "10.50")
+	if _, err := m.Pack(); err == nil {
+		t.Errorf("Expected error for non numeric amount")
+	}
+
+	m = NewMessage("0100")
+	m.Set(18, "54111")
+	if _, err := m.Pack(); err == nil {
+		t.Errorf("Expected error for oversized MCC")
+	}
+
+	m = NewMessage("0100")
+	m.Set(5, "1")
+	if _, err := m.Pack(); err == nil {
+		t.Errorf("Expected error for unsupported field")
+	}
+}
+
+func TestUnpackTruncated(t *testing.T) {
+
+	m := NewMessage("0100")
+	m.Set(2, "4111111111111111")
+	m.Set(4, "100")
+
+	b, _ := m.Pack()
+	for i := 0; i < len(b); i++ {
+		if _, err := Unpack(b[:i]); err == nil {
+			t.Errorf("Expected error for message truncated at %d bytes", i)
+		}
+	}
+}
+
+func TestResponseMTI(t *testing.T) {
+
+	cases := map[string]string{"0100": "0110", "0200": "0210", "0110": "0110", "0400": "0410"}
+	for in, expected := range cases {
+		if got := ResponseMTI(in); got != expected {
+			t.Errorf("ResponseMTI(%s): expected %s. Got %s", in, expected, got)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, []byte("0800")); err != nil {
+		t.Fatalf("WriteFrame: unexpected error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0, 4, '0', '8', '0', '0'}) {
+		t.Errorf("Unexpected frame %v", buf.Bytes())
+	}
+
+	b, err := ReadFrame(&buf)
+	if err != nil || string(b) != "0800" {
+		t.Errorf("ReadFrame: expected 0800. Got %q (%v)", b, err)
+	}
+}
@@ -0,0 +1,112 @@
+package job
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job armazena uma tarefa executada periodicamente em segundo plano
+//
+// A tarefa roda uma vez logo no início e depois a cada intervalo; uma
+// execução nunca se sobrepõe à anterior. Erros da tarefa são registrados no
+// logger e não interrompem o job.
+type Job struct {
+	name     string
+	interval time.Duration
+	task     func() error
+	log      *log.Logger
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// GetJob retorna o job com o nome informado
+func GetJob(name string) *Job {
+	return &Job{
+		name: name,
+		log:  log.New(ioutil.Discard, "", 0),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// WithInterval adiciona o intervalo entre as execuções
+func (j *Job) WithInterval(interval time.Duration) *Job {
+	j.interval = interval
+	return j
+}
+
+// WithTask adiciona a tarefa executada pelo job
+func (j *Job) WithTask(task func() error) *Job {
+	j.task = task
+	return j
+}
+
+// WithLogger adiciona o logger ao job
+func (j *Job) WithLogger(l *log.Logger) *Job {
+	j.log = l
+	return j
+}
+
+// StartJob inicia a execução periódica em segundo plano
+func (j *Job) StartJob() error {
+	if j.interval <= 0 {
+		return errors.New("Job missing interval")
+	}
+
+	if j.task == nil {
+		return errors.New("Job missing task")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.started || j.stopped {
+		return errors.New("Job already started")
+	}
+	j.started = true
+
+	go j.run()
+	return nil
+}
+
+// CloseJob interrompe o job e aguarda a execução em andamento
+func (j *Job) CloseJob() {
+	j.mu.Lock()
+	started, stopped := j.started, j.stopped
+	if !stopped {
+		j.stopped = true
+		close(j.stop)
+	}
+	j.mu.Unlock()
+
+	// job que nunca foi iniciado não tem execução para aguardar
+	if started {
+		<-j.done
+	}
+}
+
+// run executa a tarefa até o job ser interrompido
+func (j *Job) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.task(); err != nil {
+			j.log.Printf("job %s: %v", j.name, err)
+		}
+
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJobRunsUntilClosed(t *testing.T) {
+
+	var runs int32
+	j := GetJob("test").
+		WithInterval(10 * time.Millisecond).
+		WithTask(func() error {
+			atomic.AddInt32(&runs, 1)
+			return errors.New("falha ignorada")
+		})
+
+	if err := j.StartJob(); err != nil {
+		t.Fatalf("StartJob: unexpected error %v", err)
+	}
+	if err := j.StartJob(); err == nil {
+		t.Errorf("Expected error starting the job twice")
+	}
+
+	time.Sleep(55 * time.Millisecond)
+	j.CloseJob()
+
+	got := atomic.LoadInt32(&runs)
+	if got < 2 {
+		t.Errorf("Expected the task to run repeatedly. Got %d runs", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != got {
+		t.Errorf("Expected no runs after CloseJob")
+	}
+
+	// fechar de novo não bloqueia
+	j.CloseJob()
+}
+
+func TestJobRequiresTask(t *testing.T) {
+
+	j := GetJob("test").WithInterval(time.Second)
+	if err := j.StartJob(); err == nil {
+		t.Errorf("Expected error for job without task")
+	}
+
+	// job não iniciado fecha sem bloquear
+	j.CloseJob()
+}
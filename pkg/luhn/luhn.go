@@ -0,0 +1,35 @@
+// Package luhn gera e valida números de cartão pelo algoritmo de Luhn (mod 10)
+package luhn
+
+// CheckDigit retorna o dígito verificador a ser acrescentado ao número
+// informado, que deve conter apenas dígitos
+func CheckDigit(number string) byte {
+	sum := 0
+	double := true
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Valid indica se o número, com o dígito verificador no fim, passa na
+// verificação de Luhn
+func Valid(number string) bool {
+	if len(number) < 2 {
+		return false
+	}
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+	}
+	return CheckDigit(number[:len(number)-1]) == number[len(number)-1]
+}
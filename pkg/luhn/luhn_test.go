@@ -0,0 +1,32 @@
+package luhn
+
+import "testing"
+
+func TestCheckDigit(t *testing.T) {
+	cases := map[string]byte{
+		"7992739871":      '3',
+		"453201511283036": '6',
+		"0":               '0',
+	}
+	for number, expected := range cases {
+		if got := CheckDigit(number); got != expected {
+			t.Errorf("CheckDigit(%q): expected %c. Got %c", number, expected, got)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	cases := map[string]bool{
+		"79927398713":      true,
+		"4532015112830366": true,
+		"4532015112830367": false,
+		"4532a15112830366": false,
+		"":                 false,
+		"5":                false,
+	}
+	for number, expected := range cases {
+		if got := Valid(number); got != expected {
+			t.Errorf("Valid(%q): expected %v. Got %v", number, expected, got)
+		}
+	}
+}
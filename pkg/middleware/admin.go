@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// Admin é um middleware que exige o token administrativo no cabeçalho Admin-Token
+func Admin(token string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// sem token configurado as rotas administrativas ficam desabilitadas
+			if token == "" {
+				http.Error(w, "Rotas administrativas desabilitadas", http.StatusForbidden)
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Admin-Token")), []byte(token)) != 1 {
+				http.Error(w, "Token administrativo inválido", http.StatusUnauthorized)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money armazena um valor monetário exato em centavos
+//
+// No JSON o valor é escrito como número com exatamente duas casas decimais
+// (ex.: 10.50) e pode ser lido tanto como número quanto como string. No banco
+// o valor é mapeado para numeric(15,2).
+type Money int64
+
+// maxCents é o maior valor suportado por numeric(15,2)
+const maxCents = 999999999999999
+
+// ErrInvalid erro retornado para valores monetários inválidos
+var ErrInvalid = errors.New("Valor monetário inválido")
+
+// FromCents cria um valor a partir da quantidade de centavos
+func FromCents(cents int64) Money {
+	return Money(cents)
+}
+
+// Parse converte uma string decimal (ex.: "10", "10.5", "-3.20") em Money
+// sem passar por ponto flutuante; mais de duas casas decimais é erro
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalid
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	units, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		units, frac = s[:i], s[i+1:]
+	}
+	if units == "" || len(frac) > 2 || !digits(units) || !digits(frac) {
+		return 0, ErrInvalid
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	cents, err := strconv.ParseInt(units+frac, 10, 64)
+	if err != nil || cents > maxCents {
+		return 0, ErrInvalid
+	}
+
+	if negative {
+		cents = -cents
+	}
+
+	return Money(cents), nil
+}
+
+// digits verifica se a string contém apenas dígitos
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents retorna o valor em centavos
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// String formata o valor com duas casas decimais
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON escreve o valor como número com duas casas decimais
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON lê o valor de um número ou de uma string JSON
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+// Value grava o valor no banco como numeric
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan lê o valor numeric do banco
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = Money(math.Round(v * 100))
+	default:
+		return fmt.Errorf("Tipo %T não suportado para valor monetário", value)
+	}
+	return nil
+}
+
+// scanString lê o numeric retornado como texto pelo driver
+func (m *Money) scanString(s string) error {
+	// colunas migradas podem vir com mais casas decimais
+	if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > 2 {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return ErrInvalid
+		}
+		*m = Money(math.Round(f * 100))
+		return nil
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+// GormDataType define o tipo da coluna no banco
+func (Money) GormDataType() string {
+	return "numeric(15,2)"
+}
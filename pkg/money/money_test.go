@@ -0,0 +1,99 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	cases := map[string]Money{
+		"10":      1000,
+		"10.5":    1050,
+		"10.50":   1050,
+		"0.1":     10,
+		"-3.20":   -320,
+		"+7.07":   707,
+		" 1.00 ":  100,
+		"1000.00": 100000,
+	}
+
+	for in, expected := range cases {
+		got, err := Parse(in)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error %v", in, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("Parse(%q): expected %d. Got %d", in, expected, got)
+		}
+	}
+
+	for _, in := range []string{"", ".", "1.234", "abc", "1,00", "-", "1e3", "99999999999999.00"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q): expected error", in)
+		}
+	}
+}
+
+func TestRepeatedDebitsDoNotDrift(t *testing.T) {
+
+	balance, _ := Parse("1.00")
+	debit, _ := Parse("0.1")
+
+	for i := 0; i < 10; i++ {
+		balance -= debit
+	}
+
+	if balance != 0 {
+		t.Errorf("Expected balance 0.00. Got %s", balance)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+
+	var v struct {
+		Amount Money `json:"amount"`
+	}
+
+	for _, in := range []string{`{"amount":10.5}`, `{"amount":"10.50"}`} {
+		if err := json.Unmarshal([]byte(in), &v); err != nil {
+			t.Fatalf("Unmarshal(%s): unexpected error %v", in, err)
+		}
+
+		out, _ := json.Marshal(v)
+		if string(out) != `{"amount":10.50}` {
+			t.Errorf("Marshal: expected {\"amount\":10.50}. Got %s", out)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount":10.505}`), &v); err == nil {
+		t.Errorf("Unmarshal: expected error for more than two decimals")
+	}
+}
+
+func TestScan(t *testing.T) {
+
+	cases := []struct {
+		in       interface{}
+		expected Money
+	}{
+		{[]byte("12.34"), 1234},
+		{"12.3", 1230},
+		{"0.1000000000000000055", 10},
+		{int64(5), 500},
+		{float64(0.3), 30},
+		{nil, 0},
+	}
+
+	for _, c := range cases {
+		var m Money
+		if err := m.Scan(c.in); err != nil {
+			t.Errorf("Scan(%v): unexpected error %v", c.in, err)
+			continue
+		}
+		if m != c.expected {
+			t.Errorf("Scan(%v): expected %d. Got %d", c.in, c.expected, m)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package payroll
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"cajueiro/pkg/money"
+)
+
+// formatos de arquivo da folha de benefícios
+const (
+	FormatCSV   = "csv"
+	FormatFixed = "fixed"
+)
+
+// layout do formato de largura fixa, em colunas (a partir de 1):
+//
+//	01-11 CPF, só dígitos
+//	12-26 categoria da carteira, alinhada à esquerda e completada com espaços
+//	27-41 valor em centavos, alinhado à direita e completado com zeros
+//	42-49 último dia de validade do crédito, AAAAMMDD, opcional
+const (
+	fixedCPF      = 11
+	fixedWallet   = 15
+	fixedAmount   = 15
+	fixedExpires  = 8
+	fixedLineSize = fixedCPF + fixedWallet + fixedAmount
+)
+
+// ErrFormat formato de arquivo desconhecido
+var ErrFormat = errors.New("Formato de arquivo inválido, use csv ou fixed")
+
+// Record crédito de uma linha do arquivo
+type Record struct {
+	Line    int         // NÚMERO DA LINHA NO ARQUIVO
+	CPF     string      // SÓ DÍGITOS
+	Wallet  string      // CATEGORIA EM MINÚSCULAS
+	Amount  money.Money // VALOR DO CRÉDITO
+	Expires *time.Time  // ÚLTIMO DIA DE VALIDADE (DATA EM UTC), NIL SEM VALIDADE
+	Err     string      // ERRO DE FORMATO DA LINHA, VAZIO SE VÁLIDA
+}
+
+// Parse lê o arquivo e retorna um registro por linha de crédito
+//
+// Erros de formato de uma linha ficam no registro correspondente, de forma
+// que o arquivo inteiro é validado de uma vez; o erro retornado indica que
+// o arquivo não pôde ser lido.
+func Parse(r io.Reader, format string) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatFixed:
+		return parseFixed(r)
+	}
+	return nil, ErrFormat
+}
+
+// parseCSV lê o CSV com cabeçalho e as colunas cpf, wallet (ou category),
+// amount e, opcionalmente, expires_at, separadas por vírgula ou ponto e vírgula
+//
+// Cada linha é lida separadamente para que os erros apontem a linha do
+// arquivo; campos com quebra de linha não são aceitos.
+func parseCSV(r io.Reader) ([]Record, error) {
+
+	var (
+		records []Record
+		index   map[string]int
+		comma   = ','
+	)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		// a primeira linha é o cabeçalho e define o separador
+		if index == nil {
+			text = strings.TrimPrefix(text, "\ufeff")
+			if strings.Count(text, ";") > strings.Count(text, ",") {
+				comma = ';'
+			}
+			columns, err := splitCSV(text, comma)
+			if err != nil {
+				return nil, errors.New("Cabeçalho do arquivo inválido")
+			}
+			if index, err = headerIndex(columns); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		fields, err := splitCSV(text, comma)
+		if err != nil {
+			records = append(records, Record{Line: line, Err: "Linha mal formatada"})
+			continue
+		}
+
+		get := func(c string) string {
+			if i, ok := index[c]; ok && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		amount, err := parseAmount(get("amount"))
+		rec := newRecord(line, get("cpf"), get("wallet"), amount, err)
+		if rec.Err == "" {
+			rec.Expires, rec.Err = parseExpires(get("expires_at"), "2006-01-02", "02/01/2006")
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if index == nil {
+		return nil, errors.New("Arquivo vazio")
+	}
+
+	return records, nil
+}
+
+// splitCSV separa os campos de uma linha do CSV
+func splitCSV(text string, comma rune) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.Read()
+}
+
+// headerIndex retorna a posição de cada coluna obrigatória do cabeçalho
+func headerIndex(columns []string) (map[string]int, error) {
+
+	index := map[string]int{}
+	for i, c := range columns {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "category" {
+			c = "wallet"
+		}
+		index[c] = i
+	}
+
+	for _, c := range []string{"cpf", "wallet", "amount"} {
+		if _, ok := index[c]; !ok {
+			return nil, errors.New("Coluna obrigatória ausente no cabeçalho: " + c)
+		}
+	}
+
+	return index, nil
+}
+
+// parseFixed lê o arquivo no layout de largura fixa
+func parseFixed(r io.Reader) ([]Record, error) {
+
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if len(text) != fixedLineSize && len(text) != fixedLineSize+fixedExpires {
+			records = append(records, Record{Line: line, Err: "Tamanho da linha inválido"})
+			continue
+		}
+
+		digits := text[fixedCPF+fixedWallet : fixedLineSize]
+		cents, err := strconv.ParseInt(digits, 10, 64)
+		if err == nil && strings.Trim(digits, "0123456789") != "" {
+			err = money.ErrInvalid
+		}
+
+		rec := newRecord(line, text[:fixedCPF], text[fixedCPF:fixedCPF+fixedWallet], money.FromCents(cents), err)
+		if rec.Err == "" {
+			rec.Expires, rec.Err = parseExpires(text[fixedLineSize:], "20060102")
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// newRecord valida os campos da linha e monta o registro
+func newRecord(line int, cpf, wallet string, amount money.Money, err error) Record {
+
+	rec := Record{
+		Line:   line,
+		CPF:    strings.NewReplacer(".", "", "-", "", " ", "").Replace(cpf),
+		Wallet: strings.ToLower(strings.TrimSpace(wallet)),
+		Amount: amount,
+	}
+
+	switch {
+	case len(rec.CPF) != 11 || strings.Trim(rec.CPF, "0123456789") != "":
+		rec.Err = "CPF inválido"
+	case rec.Wallet == "":
+		rec.Err = "Categoria não informada"
+	case err != nil:
+		rec.Err = "Valor inválido"
+	case rec.Amount <= 0:
+		rec.Err = "Valor deve ser maior que zero"
+	}
+
+	return rec
+}
+
+// parseExpires lê o último dia de validade em um dos layouts informados;
+// vazio é um crédito sem validade
+func parseExpires(s string, layouts ...string) (*time.Time, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ""
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, ""
+		}
+	}
+	return nil, "Validade inválida"
+}
+
+// parseAmount aceita o valor com ponto decimal ("1234.56") ou no formato
+// brasileiro ("1.234,56")
+func parseAmount(s string) (money.Money, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ",") {
+		s = strings.Replace(strings.Replace(s, ".", "", -1), ",", ".", 1)
+	}
+	return money.Parse(s)
+}
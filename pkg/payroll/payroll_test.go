@@ -0,0 +1,116 @@
+package payroll
+
+import (
+	"strings"
+	"testing"
+
+	"cajueiro/pkg/money"
+)
+
+func TestParseCSV(t *testing.T) {
+
+	file := "CPF;Categoria;Amount\n" +
+		"111.111.111-11;food;800,00\n" +
+		"22222222222;MEAL;1.234,56\n" +
+		"\n" +
+		"3333;food;10\n" +
+		"44444444444;;10\n" +
+		"55555555555;food;abc\n" +
+		"66666666666;food;0\n"
+
+	// cabeçalho com "categoria" não é reconhecido
+	if _, err := Parse(strings.NewReader(file), FormatCSV); err == nil {
+		t.Fatal("Expected missing wallet column error")
+	}
+
+	file = strings.Replace(file, "Categoria", "wallet", 1)
+	records, err := Parse(strings.NewReader(file), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{
+		{Line: 2, CPF: "11111111111", Wallet: "food", Amount: money.FromCents(80000)},
+		{Line: 3, CPF: "22222222222", Wallet: "meal", Amount: money.FromCents(123456)},
+		{Line: 5, Err: "CPF inválido"},
+		{Line: 6, Err: "Categoria não informada"},
+		{Line: 7, Err: "Valor inválido"},
+		{Line: 8, Err: "Valor deve ser maior que zero"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records. Got %d: %+v", len(expected), len(records), records)
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r.Line != e.Line || r.Err != e.Err {
+			t.Errorf("Record %d: expected line %d error %q. Got line %d error %q", i, e.Line, e.Err, r.Line, r.Err)
+		}
+		if e.Err == "" && (r.CPF != e.CPF || r.Wallet != e.Wallet || r.Amount != e.Amount) {
+			t.Errorf("Record %d: expected %+v. Got %+v", i, e, r)
+		}
+	}
+}
+
+func TestParseFixed(t *testing.T) {
+
+	file := "11111111111food           000000000080000\r\n" +
+		"22222222222meal           00000000006000\n" +
+		"33333333333meal           0000000000060x0\n"
+
+	records, err := Parse(strings.NewReader(file), FormatFixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records. Got %d", len(records))
+	}
+
+	if r := records[0]; r.Err != "" || r.CPF != "11111111111" || r.Wallet != "food" || r.Amount != money.FromCents(80000) {
+		t.Errorf("Expected food 800.00 for 11111111111. Got %+v", r)
+	}
+	if records[1].Err != "Tamanho da linha inválido" {
+		t.Errorf("Expected line size error. Got %q", records[1].Err)
+	}
+	if records[2].Err != "Valor inválido" {
+		t.Errorf("Expected amount error. Got %q", records[2].Err)
+	}
+
+	if _, err := Parse(strings.NewReader(file), "xls"); err != ErrFormat {
+		t.Errorf("Expected ErrFormat. Got %v", err)
+	}
+}
+
+func TestParseExpires(t *testing.T) {
+
+	file := "cpf,wallet,amount,expires_at\n" +
+		"11111111111,food,10,2021-03-31\n" +
+		"22222222222,food,10,31/03/2021\n" +
+		"33333333333,food,10,\n" +
+		"44444444444,food,10,31-03-2021\n"
+
+	records, err := Parse(strings.NewReader(file), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if r := records[i]; r.Expires == nil || r.Expires.Format("2006-01-02") != "2021-03-31" {
+			t.Errorf("Line %d: expected expiry 2021-03-31. Got %v", r.Line, r.Expires)
+		}
+	}
+	if records[2].Expires != nil || records[2].Err != "" {
+		t.Errorf("Expected credit without expiry. Got %+v", records[2])
+	}
+	if records[3].Err != "Validade inválida" {
+		t.Errorf("Expected expiry error. Got %q", records[3].Err)
+	}
+
+	fixed := "11111111111food           00000000008000020210331\n"
+	records, err = Parse(strings.NewReader(fixed), FormatFixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := records[0]; r.Err != "" || r.Expires == nil || r.Expires.Format("2006-01-02") != "2021-03-31" {
+		t.Errorf("Expected fixed-width credit expiring 2021-03-31. Got %+v", r)
+	}
+}
@@ -0,0 +1,170 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// layout da página A4 em pontos
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 40
+	fontSize     = 9
+	lineHeight   = 12
+	linesPerPage = (pageHeight - 2*margin) / lineHeight
+)
+
+// objetos reservados no início do arquivo
+const (
+	catalogObject = 1
+	pagesObject   = 2
+	fontObject    = 3
+	firstFree     = 4
+)
+
+// Writer gera um PDF de texto simples em fonte monoespaçada, escrevendo cada
+// página assim que ela fica cheia
+//
+// Só a página corrente e a posição de cada objeto ficam em memória, de forma
+// que documentos longos podem ser gerados direto na resposta HTTP. O texto é
+// convertido para WinAnsi (Windows-1252); caracteres fora dela viram "?".
+type Writer struct {
+	w       *bufio.Writer
+	offset  int
+	offsets map[int]int
+	next    int
+	pages   []int
+	page    []string
+	err     error
+	closed  bool
+}
+
+// NewWriter inicia o documento escrevendo o cabeçalho em w
+func NewWriter(w io.Writer) *Writer {
+	p := &Writer{
+		w:       bufio.NewWriter(w),
+		offsets: map[int]int{},
+		next:    firstFree,
+	}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+// Line adiciona uma linha de texto, abrindo uma nova página quando necessário
+func (p *Writer) Line(text string) error {
+	if p.closed {
+		return errors.New("PDF já finalizado")
+	}
+
+	p.page = append(p.page, text)
+	if len(p.page) == linesPerPage {
+		p.flushPage()
+	}
+	return p.err
+}
+
+// Close escreve a última página, o catálogo e a tabela de referências
+func (p *Writer) Close() error {
+	if p.closed {
+		return p.err
+	}
+	p.closed = true
+
+	if len(p.page) > 0 || len(p.pages) == 0 {
+		p.flushPage()
+	}
+
+	kids := make([]string, len(p.pages))
+	for i, page := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+
+	p.object(fontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	p.object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	p.object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+
+	// tabela de referências com a posição de cada objeto
+	xref := p.offset
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", p.next)
+	for i := 1; i < p.next; i++ {
+		p.printf("%010d 00000 n \n", p.offsets[i])
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.next, catalogObject, xref)
+
+	if p.err == nil {
+		p.err = p.w.Flush()
+	}
+	return p.err
+}
+
+// flushPage escreve o conteúdo da página corrente e o objeto da página
+func (p *Writer) flushPage() {
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, lineHeight, margin, pageHeight-margin)
+	for _, line := range p.page {
+		fmt.Fprintf(&content, "(%s) '\n", escape(line))
+	}
+	content.WriteString("ET")
+
+	contents := p.reserve()
+	p.object(contents, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+
+	page := p.reserve()
+	p.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> >> >>",
+		pagesObject, pageWidth, pageHeight, contents, fontObject))
+
+	p.pages = append(p.pages, page)
+	p.page = p.page[:0]
+
+	if p.err == nil {
+		p.err = p.w.Flush()
+	}
+}
+
+// reserve retorna o próximo número de objeto livre
+func (p *Writer) reserve() int {
+	n := p.next
+	p.next++
+	return n
+}
+
+// object escreve o objeto n registrando a sua posição
+func (p *Writer) object(n int, body string) {
+	p.offsets[n] = p.offset
+	p.printf("%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+// printf escreve no documento contando os bytes para a tabela de referências
+func (p *Writer) printf(format string, a ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, a...)
+	p.offset += n
+	p.err = err
+}
+
+// escape converte o texto para WinAnsi e escapa os delimitadores de string
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok || c < 0x20 {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriterPagesAndXref(t *testing.T) {
+
+	var buf bytes.Buffer
+	p := NewWriter(&buf)
+	for i := 0; i < linesPerPage*2+1; i++ {
+		if err := p.Line(fmt.Sprintf("Linha %d - Pão (R$ 10,00)", i)); err != nil {
+			t.Fatalf("Line: unexpected error %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close: unexpected error %v", err)
+	}
+
+	doc := buf.String()
+	if !strings.HasPrefix(doc, "%PDF-1.4") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatalf("Unexpected PDF envelope")
+	}
+	if !strings.Contains(doc, "/Count 3") {
+		t.Errorf("Expected 3 pages")
+	}
+	if !strings.Contains(doc, "(Linha 0 - P\xe3o \\(R$ 10,00\\)) '") {
+		t.Errorf("Expected WinAnsi text with escaped parentheses")
+	}
+
+	// cada entrada da tabela aponta para o início do objeto correspondente
+	start := strings.LastIndex(doc, "startxref\n")
+	xref, _ := strconv.Atoi(strings.Fields(doc[start+len("startxref\n"):])[0])
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(e[1])
+		if !strings.HasPrefix(doc[offset:], fmt.Sprintf("%d 0 obj", i+1)) {
+			t.Errorf("Object %d: xref offset %d does not point to the object", i+1, offset)
+		}
+	}
+}
+
+func TestWriterEmptyDocument(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatalf("Close: unexpected error %v", err)
+	}
+	if !strings.Contains(buf.String(), "/Count 1") {
+		t.Errorf("Expected a single blank page")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+
+	"cajueiro/pkg/iso8583"
+)
+
+// ISOServer armazena o servidor TCP de autorização ISO 8583
+//
+// Cada mensagem é prefixada com o tamanho em 2 bytes big-endian. As mensagens
+// de uma mesma conexão são processadas em paralelo e as respostas são
+// escritas na ordem em que ficam prontas; o cliente casa a resposta pelo STAN.
+type ISOServer struct {
+	addr     string
+	handler  iso8583.HandlerFunc
+	log      *log.Logger
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// GetISOServer retorna o servidor ISO 8583
+func GetISOServer() *ISOServer {
+	return &ISOServer{
+		log:   log.New(ioutil.Discard, "", 0),
+		conns: map[net.Conn]struct{}{},
+	}
+}
+
+// WithAddr adiciona o endereço ao servidor
+func (s *ISOServer) WithAddr(addr string) *ISOServer {
+	s.addr = addr
+	return s
+}
+
+// WithLogger adiciona o logger ao servidor
+func (s *ISOServer) WithLogger(l *log.Logger) *ISOServer {
+	s.log = l
+	return s
+}
+
+// WithHandler adiciona o handler das mensagens ao servidor
+func (s *ISOServer) WithHandler(h iso8583.HandlerFunc) *ISOServer {
+	s.handler = h
+	return s
+}
+
+// StartServer abre o listener TCP e atende as conexões
+func (s *ISOServer) StartServer() error {
+	if len(s.addr) == 0 {
+		return errors.New("ISO server missing address")
+	}
+
+	if s.handler == nil {
+		return errors.New("ISO server missing handler")
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// serve lê as mensagens da conexão até o cliente desconectar
+func (s *ISOServer) serve(conn net.Conn) {
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+	)
+
+	defer func() {
+		wg.Wait()
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	for {
+		frame, err := iso8583.ReadFrame(conn)
+		if err != nil {
+			if err != io.EOF {
+				s.log.Printf("ISO 8583 %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		req, err := iso8583.Unpack(frame)
+		if err != nil {
+			// sem MTI válido não há como responder, a conexão é encerrada
+			s.log.Printf("ISO 8583 %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := s.handler(req).Pack()
+			if err != nil {
+				s.log.Printf("ISO 8583 %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := iso8583.WriteFrame(conn, resp); err != nil {
+				s.log.Printf("ISO 8583 %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// CloseServer fecha o listener e as conexões abertas
+func (s *ISOServer) CloseServer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
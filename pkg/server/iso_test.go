@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"cajueiro/pkg/iso8583"
+)
+
+func TestISOServerRoundTrip(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	srv := GetISOServer().
+		WithAddr(addr).
+		WithHandler(func(req *iso8583.Message) *iso8583.Message {
+			resp := iso8583.NewMessage(iso8583.ResponseMTI(req.MTI))
+			resp.Set(11, req.Get(11))
+			resp.Set(39, "00")
+			return resp
+		})
+
+	go srv.StartServer()
+	defer srv.CloseServer()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := iso8583.NewMessage("0100")
+	req.Set(11, "000042")
+	b, _ := req.Pack()
+	if err := iso8583.WriteFrame(conn, b); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := iso8583.ReadFrame(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := iso8583.Unpack(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.MTI != "0110" || resp.Get(11) != "000042" || resp.Get(39) != "00" {
+		t.Errorf("Unexpected response %v %v", resp.MTI, resp.Fields)
+	}
+}